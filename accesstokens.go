@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+const maxAccessTokenNameLength = 100
+
+// principal is the user a request acts for and what it may do.
+type principal struct {
+	UserID uuid.UUID
+	// Scopes is nil for a login session, which may do everything.
+	Scopes []string
+	// EmailVerified is only known from access tokens. False may be
+	// outdated and should be checked against the database.
+	EmailVerified bool
+}
+
+func (p principal) can(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+// authenticate accepts access tokens from a login, access tokens issued to
+// OAuth clients and personal access tokens.
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		pat, err := cfg.db.UsePersonalAccessToken(r.Context(), auth.HashToken(token))
+		if err != nil {
+			return principal{}, errors.New("invalid, expired or revoked personal access token")
+		}
+		return principal{UserID: pat.UserID, Scopes: pat.Scopes}, nil
+	}
+
+	claims, err := cfg.parseAccessToken(r.Context(), token)
+	if err != nil {
+		return principal{}, err
+	}
+	p := principal{UserID: uuid.MustParse(claims.Subject), EmailVerified: claims.EmailVerified}
+	if !claims.IsSession() {
+		p.Scopes = claims.Scopes()
+	}
+	return p, nil
+}
+
+// authorize authenticates the request and checks that it was granted scope.
+// If not, it responds with an error and returns false.
+func (cfg *apiConfig) authorize(w http.ResponseWriter, r *http.Request, scope string) (principal, bool) {
+	p, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return principal{}, false
+	}
+	if !p.can(scope) {
+		respondWithError(w, http.StatusForbidden, "Token is missing the "+scope+" scope")
+		return principal{}, false
+	}
+	return p, true
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func personalAccessTokenResponse(pat database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Scopes:     pat.Scopes,
+		CreatedAt:  pat.CreatedAt,
+		ExpiresAt:  nullTimePtr(pat.ExpiresAt),
+		LastUsedAt: nullTimePtr(pat.LastUsedAt),
+	}
+}
+
+// Managing personal access tokens takes a login session: a token can't be
+// used to mint or list other tokens.
+
+func (cfg *apiConfig) createAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	var req parameters
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	if req.Name == "" || len(req.Name) > maxAccessTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters")
+		return
+	}
+
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "Expiry must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: req.ExpiresAt.UTC(), Valid: true}
+	}
+
+	plaintext, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	pat, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: auth.HashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	// The token itself is only ever shown in this response.
+	response := personalAccessTokenResponse(pat)
+	response.Token = plaintext
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) listAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	pats, err := cfg.db.GetPersonalAccessTokensByUserID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tokens")
+		return
+	}
+
+	tokens := []PersonalAccessToken{}
+	for _, pat := range pats {
+		tokens = append(tokens, personalAccessTokenResponse(pat))
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) revokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	revoked, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
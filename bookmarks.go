@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/pagination"
+)
+
+// BookmarkedChirp is a chirp in the caller's bookmarks.
+type BookmarkedChirp struct {
+	Chirp
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+// bookmarkCursor is the sort key of the last bookmark on a page.
+type bookmarkCursor struct {
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+	ChirpID      uuid.UUID `json:"chirp_id"`
+}
+
+// bookmarkChirpHandler saves a chirp to the caller's bookmarks. Bookmarks
+// are private, so only login sessions may use them. Bookmarking a chirp
+// again changes nothing.
+func (cfg *apiConfig) bookmarkChirpHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	// Bookmarking a rechirp bookmarks the chirp it reposts.
+	chirp, err := cfg.repostTarget(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't bookmark chirp")
+		return
+	}
+
+	err = cfg.db.CreateBookmark(r.Context(), database.CreateBookmarkParams{
+		UserID:  userID,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't bookmark chirp")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeBookmarkHandler removes a chirp from the caller's bookmarks.
+// Chirps that aren't bookmarked are left alone.
+func (cfg *apiConfig) removeBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	// As with likes, only a rechirp needs resolving to the chirp that was
+	// bookmarked.
+	chirp, err := cfg.repostTarget(r.Context(), chirpID)
+	switch {
+	case err == nil:
+		chirpID = chirp.ID
+	case !errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove bookmark")
+		return
+	}
+
+	err = cfg.db.DeleteBookmark(r.Context(), database.DeleteBookmarkParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove bookmark")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBookmarksHandler lists the caller's bookmarks, most recently
+// bookmarked first. Deleted chirps are left out; once they are purged their
+// bookmarks go with them.
+func (cfg *apiConfig) listBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListBookmarksParams{UserID: userID}
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		var cursor bookmarkCursor
+		if err := pagination.DecodeCursor(cursorParam, &cursor); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.BookmarkedAt, Valid: true}
+		params.BeforeChirpID = uuid.NullUUID{UUID: cursor.ChirpID, Valid: true}
+	}
+
+	rows, err := fetchPage(cfg, w, r, limit, func(limit int32) ([]database.ListBookmarksRow, error) {
+		params.Limit = limit
+		return cfg.db.ListBookmarks(r.Context(), params)
+	}, func(last database.ListBookmarksRow) any {
+		return bookmarkCursor{BookmarkedAt: last.BookmarkedAt, ChirpID: last.Chirp.ID}
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list bookmarks")
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, chirpFromDB(row.Chirp))
+	}
+	if err := cfg.annotateChirps(r.Context(), userID, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load chirps")
+		return
+	}
+
+	result := make([]BookmarkedChirp, 0, len(rows))
+	for i, row := range rows {
+		result = append(result, BookmarkedChirp{Chirp: chirps[i], BookmarkedAt: row.BookmarkedAt})
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
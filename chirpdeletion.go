@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+const (
+	defaultChirpRestoreWindow = 7 * 24 * time.Hour
+	defaultChirpRetention     = 30 * 24 * time.Hour
+	deletedChirpPurgeInterval = time.Hour
+)
+
+// chirpDeletionFromEnv reads how long authors can restore a deleted chirp
+// (CHIRP_RESTORE_WINDOW) and how long deleted chirps are kept before they
+// are purged (CHIRP_RETENTION).
+func chirpDeletionFromEnv() (restoreWindow, retention time.Duration, err error) {
+	envDuration := func(name string, value *time.Duration) error {
+		raw := os.Getenv(name)
+		if raw == "" {
+			return nil
+		}
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if parsed <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+		*value = parsed
+		return nil
+	}
+
+	restoreWindow, retention = defaultChirpRestoreWindow, defaultChirpRetention
+	if err := envDuration("CHIRP_RESTORE_WINDOW", &restoreWindow); err != nil {
+		return 0, 0, err
+	}
+	if err := envDuration("CHIRP_RETENTION", &retention); err != nil {
+		return 0, 0, err
+	}
+	// A chirp that can still be restored must not be purged.
+	if retention < restoreWindow {
+		return 0, 0, errors.New("CHIRP_RETENTION must not be less than CHIRP_RESTORE_WINDOW")
+	}
+	return restoreWindow, retention, nil
+}
+
+// DeletedChirp is a chirp as moderators see it, deleted or not.
+type DeletedChirp struct {
+	Chirp
+	Deleted   bool       `json:"deleted"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// restoreChirpHandler undoes the deletion of one of the caller's chirps,
+// as long as it was deleted less than the restore window ago.
+func (cfg *apiConfig) restoreChirpHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	chirp, err := cfg.db.RestoreChirp(r.Context(), database.RestoreChirpParams{
+		ID:        chirpID,
+		UserID:    caller.UserID,
+		DeletedAt: sql.NullTime{Time: time.Now().UTC().Add(-cfg.chirpRestoreWindow), Valid: true},
+	})
+	// Someone else's chirp, one that isn't deleted and one past the window
+	// all look the same, so nothing is revealed about other users' chirps.
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "No deleted chirp to restore")
+		return
+	}
+	// A user has at most one rechirp of a chirp, so a deleted rechirp can't
+	// come back once the chirp has been rechirped again.
+	if isUniqueViolation(err, "chirps_rechirp_unique_idx") {
+		respondWithError(w, http.StatusConflict, "The chirp has already been rechirped again")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore chirp")
+		return
+	}
+	cfg.respondWithChirp(w, r, caller.UserID, http.StatusOK, chirp)
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a row because
+// of the unique constraint or index named constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// moderatorChirpHandler returns a chirp even if it has been deleted, until
+// it is purged.
+func (cfg *apiConfig) moderatorChirpHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	chirp, err := cfg.db.GetChirpIncludingDeleted(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp")
+		return
+	}
+	viewer := uuid.MustParse(claimsFromContext(r.Context()).Subject)
+	result := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.annotateChirps(r.Context(), viewer, result); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load chirps")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, DeletedChirp{
+		Chirp:     result[0],
+		Deleted:   chirp.DeletedAt.Valid,
+		DeletedAt: nullTimePtr(chirp.DeletedAt),
+	})
+}
+
+// purgeDeletedChirps permanently removes chirps deleted longer than the
+// retention period ago.
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) {
+	cutoff := sql.NullTime{Time: time.Now().UTC().Add(-cfg.chirpRetention), Valid: true}
+	purged, err := cfg.db.PurgeDeletedChirps(ctx, cutoff)
+	if err != nil {
+		log.Printf("couldn't purge deleted chirps: %s", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d deleted chirps", purged)
+	}
+}
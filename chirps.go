@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/pagination"
+	"github.com/sabrek15/chirpy/internal/search"
+)
+
+// maxChirpLength is the longest chirp body accepted, in bytes.
+const maxChirpLength = 140
+
+// Kinds of chirps. Rechirps repost another chirp as it is and have no body
+// of their own; quotes repost it with a comment.
+const (
+	chirpKindChirp   = "chirp"
+	chirpKindRechirp = "rechirp"
+	chirpKindQuote   = "quote"
+)
+
+// Chirp is a chirp as returned by the API.
+type Chirp struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Body          string     `json:"body"`
+	UserID        uuid.UUID  `json:"user_id"`
+	Edited        bool       `json:"edited"`
+	EditedAt      *time.Time `json:"edited_at,omitempty"`
+	ReplyToID     *uuid.UUID `json:"reply_to_id,omitempty"`
+	Kind          string     `json:"kind"`
+	QuotedChirpID *uuid.UUID `json:"quoted_chirp_id,omitempty"`
+	Entities      Entities   `json:"entities"`
+
+	// The fields below are filled in by annotateChirps. QuotedChirp is left
+	// out once the reposted chirp has been deleted, Liked if nobody is
+	// signed in.
+	QuotedChirp  *Chirp `json:"quoted_chirp,omitempty"`
+	ReplyCount   int64  `json:"reply_count"`
+	RechirpCount int64  `json:"rechirp_count"`
+	QuoteCount   int64  `json:"quote_count"`
+	LikeCount    int64  `json:"like_count"`
+	Liked        *bool  `json:"liked,omitempty"`
+}
+
+func chirpFromDB(c database.Chirp) Chirp {
+	return Chirp{
+		ID:            c.ID,
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+		Body:          c.Body,
+		UserID:        c.UserID,
+		Edited:        c.EditedAt.Valid,
+		EditedAt:      nullTimePtr(c.EditedAt),
+		ReplyToID:     nullUUIDPtr(c.ReplyToID),
+		Kind:          c.Kind,
+		QuotedChirpID: nullUUIDPtr(c.QuotedChirpID),
+		Entities:      entitiesFor(c.Body),
+	}
+}
+
+func chirpsFromDB(chirps []database.Chirp) []Chirp {
+	result := make([]Chirp, 0, len(chirps))
+	for _, c := range chirps {
+		result = append(result, chirpFromDB(c))
+	}
+	return result
+}
+
+// chirpCounts are the counts shown with a chirp.
+type chirpCounts struct {
+	Replies  int64
+	Rechirps int64
+	Quotes   int64
+	Likes    int64
+}
+
+func (c chirpCounts) apply(chirp *Chirp) {
+	chirp.ReplyCount = c.Replies
+	chirp.RechirpCount = c.Rechirps
+	chirp.QuoteCount = c.Quotes
+	chirp.LikeCount = c.Likes
+}
+
+// annotateChirps fills in the reposted chirps and the counts of chirps, and
+// whether viewer liked them unless viewer is uuid.Nil. It runs the same few
+// queries however many chirps there are, rather than some for each of them.
+// Reposted chirps get their counts too, but not their own reposted chirp.
+func (cfg *apiConfig) annotateChirps(ctx context.Context, viewer uuid.UUID, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	var quotedIDs []uuid.UUID
+	for _, c := range chirps {
+		if c.QuotedChirpID != nil {
+			quotedIDs = append(quotedIDs, *c.QuotedChirpID)
+		}
+	}
+	quoted := make(map[uuid.UUID]Chirp, len(quotedIDs))
+	if len(quotedIDs) > 0 {
+		rows, err := cfg.db.GetChirpsByIDs(ctx, quotedIDs)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			quoted[row.ID] = chirpFromDB(row)
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps)+len(quoted))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+	for id := range quoted {
+		ids = append(ids, id)
+	}
+	counts, err := cfg.countChirps(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var liked map[uuid.UUID]bool
+	if viewer != uuid.Nil {
+		likedIDs, err := cfg.db.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+			UserID:   viewer,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return err
+		}
+		liked = make(map[uuid.UUID]bool, len(likedIDs))
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+	}
+	setLiked := func(chirp *Chirp) {
+		if liked != nil {
+			l := liked[chirp.ID]
+			chirp.Liked = &l
+		}
+	}
+
+	for id, q := range quoted {
+		counts[id].apply(&q)
+		setLiked(&q)
+		quoted[id] = q
+	}
+	for i := range chirps {
+		counts[chirps[i].ID].apply(&chirps[i])
+		setLiked(&chirps[i])
+		if chirps[i].QuotedChirpID != nil {
+			if q, ok := quoted[*chirps[i].QuotedChirpID]; ok {
+				chirps[i].QuotedChirp = &q
+			}
+		}
+	}
+	return nil
+}
+
+// countChirps counts the replies, reposts and likes of the chirps ids.
+// Deleted chirps don't count.
+func (cfg *apiConfig) countChirps(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]chirpCounts, error) {
+	counts := make(map[uuid.UUID]chirpCounts, len(ids))
+
+	replies, err := cfg.db.CountChirpReplies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range replies {
+		c := counts[row.ChirpID]
+		c.Replies = row.ReplyCount
+		counts[row.ChirpID] = c
+	}
+
+	reposts, err := cfg.db.CountChirpReposts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range reposts {
+		c := counts[row.ChirpID]
+		c.Rechirps = row.RechirpCount
+		c.Quotes = row.QuoteCount
+		counts[row.ChirpID] = c
+	}
+
+	likes, err := cfg.db.CountChirpLikes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range likes {
+		c := counts[row.ChirpID]
+		c.Likes = row.LikeCount
+		counts[row.ChirpID] = c
+	}
+	return counts, nil
+}
+
+// respondWithChirp responds with chirp as viewer sees it.
+func (cfg *apiConfig) respondWithChirp(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, code int, chirp database.Chirp) {
+	result := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.annotateChirps(r.Context(), viewer, result); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load chirps")
+		return
+	}
+	respondWithJSON(w, code, result[0])
+}
+
+// respondWithChirps responds with chirps as viewer sees them.
+func (cfg *apiConfig) respondWithChirps(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, code int, chirps []database.Chirp) {
+	result := chirpsFromDB(chirps)
+	if err := cfg.annotateChirps(r.Context(), viewer, result); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load chirps")
+		return
+	}
+	respondWithJSON(w, code, result)
+}
+
+// ChirpSearchResult is a chirp matching a search, with how well it matches
+// and a snippet of its body with the matches highlighted.
+type ChirpSearchResult struct {
+	Chirp
+	Rank float32 `json:"rank"`
+	// Headline is HTML: the body is escaped and matches are wrapped in
+	// <mark> tags.
+	Headline string `json:"headline"`
+}
+
+// searchCursor is the sort key of the last result on a page.
+type searchCursor struct {
+	Rank      float32   `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// searchChirpsHandler finds chirps by the words in their body, best matches
+// first. See search.ToTSQuery for the query syntax.
+func (cfg *apiConfig) searchChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := cfg.viewerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query, err := search.ToTSQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.SearchChirpsParams{Query: query}
+	if authorIDParam := r.URL.Query().Get("author_id"); authorIDParam != "" {
+		authorID, err := uuid.Parse(authorIDParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		var cursor searchCursor
+		if err := pagination.DecodeCursor(cursorParam, &cursor); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.AfterRank = sql.NullFloat64{Float64: float64(cursor.Rank), Valid: true}
+		params.AfterCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	rows, err := fetchPage(cfg, w, r, limit, func(limit int32) ([]database.SearchChirpsRow, error) {
+		params.Limit = limit
+		return cfg.db.SearchChirps(r.Context(), params)
+	}, func(last database.SearchChirpsRow) any {
+		return searchCursor{Rank: last.Rank, CreatedAt: last.CreatedAt, ID: last.ID}
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps")
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, Chirp{
+			ID:            row.ID,
+			CreatedAt:     row.CreatedAt,
+			UpdatedAt:     row.UpdatedAt,
+			Body:          row.Body,
+			UserID:        row.UserID,
+			Edited:        row.EditedAt.Valid,
+			EditedAt:      nullTimePtr(row.EditedAt),
+			ReplyToID:     nullUUIDPtr(row.ReplyToID),
+			Kind:          row.Kind,
+			QuotedChirpID: nullUUIDPtr(row.QuotedChirpID),
+			Entities:      entitiesFor(row.Body),
+		})
+	}
+	if err := cfg.annotateChirps(r.Context(), viewer, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load chirps")
+		return
+	}
+
+	results := make([]ChirpSearchResult, 0, len(rows))
+	for i, row := range rows {
+		results = append(results, ChirpSearchResult{
+			Chirp:    chirps[i],
+			Rank:     row.Rank,
+			Headline: search.SafeHeadline(row.Headline),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+// cleanChirpBody masks profanity in a new chirp body. It reports false if
+// the body is too long.
+func cleanChirpBody(body string) (string, bool) {
+	if len(body) > maxChirpLength {
+		return "", false
+	}
+	return cleanChirp(body), true
+}
+
+// ChirpRevision is an earlier version of an edited chirp.
+type ChirpRevision struct {
+	Body string `json:"body"`
+	// CreatedAt is when this version was posted, ReplacedAt when it was
+	// edited into the next one.
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// editChirpHandler replaces the body of one of the caller's chirps. The
+// previous body is kept as a revision.
+func (cfg *apiConfig) editChirpHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	var req parameters
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !cfg.checkCanPost(w, r, caller) {
+		return
+	}
+
+	body, ok := cleanChirpBody(req.Body)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't edit chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// The row stays locked until the commit, so concurrent edits each
+	// record the version they replaced.
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't edit chirp")
+		return
+	}
+	if chirp.UserID != caller.UserID {
+		respondWithError(w, http.StatusForbidden, "userID and chirp's user is different")
+		return
+	}
+	if chirp.Kind == chirpKindRechirp {
+		respondWithError(w, http.StatusBadRequest, "Rechirps can't be edited")
+		return
+	}
+	if chirp.Kind == chirpKindQuote && body == "" {
+		respondWithError(w, http.StatusBadRequest, "A quote needs a body")
+		return
+	}
+
+	if body == chirp.Body {
+		cfg.respondWithChirp(w, r, caller.UserID, http.StatusOK, chirp)
+		return
+	}
+
+	versionCreatedAt := chirp.CreatedAt
+	if chirp.EditedAt.Valid {
+		versionCreatedAt = chirp.EditedAt.Time
+	}
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+		CreatedAt: versionCreatedAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't edit chirp")
+		return
+	}
+
+	chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirp.ID,
+		Body: body,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't edit chirp")
+		return
+	}
+
+	if err := indexHashtags(r.Context(), qtx, chirp.ID, chirp.Body); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't edit chirp")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't edit chirp")
+		return
+	}
+
+	cfg.respondWithChirp(w, r, caller.UserID, http.StatusOK, chirp)
+}
+
+// chirpRevisionsHandler lists the earlier versions of a chirp, most recent
+// first.
+func (cfg *apiConfig) chirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	if _, err := cfg.db.GetChirpsByID(r.Context(), chirpID); err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	revisions, err := cfg.db.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list revisions")
+		return
+	}
+
+	result := make([]ChirpRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		result = append(result, ChirpRevision{
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
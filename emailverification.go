@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/mailer"
+)
+
+const emailVerificationExpiration = time.Hour * 24
+
+// validEmail reports whether email is a bare address such as
+// user@example.com. Display names ("User <user@example.com>") are rejected
+// too: the address is stored and mailed to as given.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// sendEmailVerification mails a verification link for email to the user. It is
+// used both for new accounts and for confirming a change of address, in which
+// case the link goes to the new address.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationExpiration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", cfg.baseURL, url.QueryEscape(token))
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Open this link to confirm %s as the email address of your Chirpy account:\n\n%s\n\n"+
+			"The link expires in %s.", email, link, emailVerificationExpiration),
+	})
+}
+
+func (cfg *apiConfig) verifyEmailLinkHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.verifyEmail(w, r, r.URL.Query().Get("token"))
+}
+
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	var req parameters
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	cfg.verifyEmail(w, r, req.Token)
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request, token string) {
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing verification token")
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	verification, err := qtx.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(token))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	// Confirming one address cancels any other pending change.
+	err = qtx.ExpireUserEmailVerificationTokens(r.Context(), verification.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email")
+		return
+	}
+
+	user, err := qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusConflict, "Email is already in use")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email")
+		return
+	}
+
+	if cfg.bootstrapAdminEmail != "" && user.Email == cfg.bootstrapAdminEmail {
+		if cfg.bootstrapAdmin(r.Context()) {
+			user.Role = string(auth.RoleAdmin)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role:          user.Role,
+	})
+}
+
+func (cfg *apiConfig) resendEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	if err := cfg.sendEmailVerification(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("couldn't send verification email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// checkCanPost checks that the caller may post chirps, which includes
+// rechirps, quotes and edits. If not, it responds with an error and returns
+// false.
+func (cfg *apiConfig) checkCanPost(w http.ResponseWriter, r *http.Request, caller principal) bool {
+	// A verified email stays verified, so only a token that says otherwise
+	// needs a second look.
+	if !cfg.requireVerifiedEmail || caller.EmailVerified {
+		return true
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find the user")
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address before posting chirps")
+		return false
+	}
+	return true
+}
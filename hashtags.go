@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/hashtags"
+	"github.com/sabrek15/chirpy/internal/pagination"
+)
+
+// Entities are the structured parts of a chirp body.
+type Entities struct {
+	Hashtags []HashtagEntity `json:"hashtags"`
+}
+
+// HashtagEntity is a hashtag in a chirp body. Start and End count
+// characters (Unicode code points), and End is exclusive.
+type HashtagEntity struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// entitiesFor finds the entities in a chirp body. They are found afresh
+// each time rather than stored, so they always match the body.
+func entitiesFor(body string) Entities {
+	found := hashtags.Extract(body)
+	entities := Entities{Hashtags: make([]HashtagEntity, 0, len(found))}
+	for _, h := range found {
+		entities.Hashtags = append(entities.Hashtags, HashtagEntity{Tag: h.Tag, Start: h.Start, End: h.End})
+	}
+	return entities
+}
+
+// indexHashtags records which hashtags the chirp chirpID with body has,
+// replacing what was recorded before. q should be in the same transaction
+// that saves the body.
+func indexHashtags(ctx context.Context, q *database.Queries, chirpID uuid.UUID, body string) error {
+	if err := q.DeleteChirpHashtags(ctx, chirpID); err != nil {
+		return err
+	}
+
+	tags := hashtags.Tags(hashtags.Extract(body))
+	if len(tags) == 0 {
+		return nil
+	}
+	if err := q.CreateHashtags(ctx, tags); err != nil {
+		return err
+	}
+	return q.AddChirpHashtags(ctx, database.AddChirpHashtagsParams{
+		ChirpID: chirpID,
+		Tags:    tags,
+	})
+}
+
+// hashtagBackfillBatchSize is how many chirps backfillHashtags indexes per
+// transaction.
+const hashtagBackfillBatchSize = 500
+
+// backfillHashtags indexes the chirps posted before hashtags were indexed,
+// which the migration that added hashtag_backfill queued up. Once the queue
+// is empty it returns after a single query.
+func (cfg *apiConfig) backfillHashtags(ctx context.Context) {
+	total := 0
+	for {
+		indexed, err := cfg.backfillHashtagBatch(ctx)
+		if err != nil {
+			log.Printf("couldn't backfill hashtags: %s", err)
+			return
+		}
+		if indexed == 0 {
+			break
+		}
+		total += indexed
+	}
+	if total > 0 {
+		log.Printf("indexed hashtags of %d older chirps", total)
+	}
+}
+
+// backfillHashtagBatch indexes the next batch of queued chirps and returns
+// how many there were. The chirps stay locked until the commit, so an edit
+// in the meantime can't be overwritten with the old body's hashtags.
+func (cfg *apiConfig) backfillHashtagBatch(ctx context.Context) (int, error) {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirps, err := qtx.ListHashtagBackfill(ctx, hashtagBackfillBatchSize)
+	if err != nil || len(chirps) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		if err := indexHashtags(ctx, qtx, chirp.ID, chirp.Body); err != nil {
+			return 0, err
+		}
+		ids = append(ids, chirp.ID)
+	}
+	if err := qtx.DeleteHashtagBackfill(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(chirps), tx.Commit()
+}
+
+// hashtagChirpsHandler lists the chirps with a hashtag, newest first.
+func (cfg *apiConfig) hashtagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := cfg.viewerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := hashtags.Normalize(r.PathValue("tag"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListHashtagChirpsParams{Tag: tag}
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		var cursor chirpCursor
+		if err := pagination.DecodeCursor(cursorParam, &cursor); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	chirps, err := fetchPage(cfg, w, r, limit, func(limit int32) ([]database.Chirp, error) {
+		params.Limit = limit
+		return cfg.db.ListHashtagChirps(r.Context(), params)
+	}, chirpCursorAfter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list chirps")
+		return
+	}
+	cfg.respondWithChirps(w, r, viewer, http.StatusOK, chirps)
+}
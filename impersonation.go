@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+const (
+	impersonationExpiration      = 15 * time.Minute
+	maxImpersonationReasonLength = 500
+	defaultImpersonationsLimit   = 50
+	maxImpersonationsLimit       = 200
+)
+
+// Impersonation is an entry of the impersonation audit log.
+type Impersonation struct {
+	ID        uuid.UUID `json:"id"`
+	AdminID   uuid.UUID `json:"admin_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Reason    string    `json:"reason"`
+	TokenID   uuid.UUID `json:"token_id"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func impersonationFromDB(i database.Impersonation) Impersonation {
+	return Impersonation{
+		ID:        i.ID,
+		AdminID:   i.AdminID,
+		UserID:    i.UserID,
+		Reason:    i.Reason,
+		TokenID:   i.TokenID,
+		UserAgent: i.UserAgent,
+		IPAddress: i.IpAddress,
+		CreatedAt: i.CreatedAt,
+		ExpiresAt: i.ExpiresAt,
+	}
+}
+
+// impersonateHandler lets an admin act as another user, to see what they
+// see. The token it returns carries the admin in its "act" claim, can't
+// manage the account and isn't refreshable. Every token is recorded in the
+// audit log before it is handed out.
+func (cfg *apiConfig) impersonateHandler(w http.ResponseWriter, r *http.Request) {
+	admin := claimsFromContext(r.Context())
+
+	defer r.Body.Close()
+	type parameters struct {
+		UserID uuid.UUID `json:"user_id"`
+		Reason string    `json:"reason"`
+	}
+	var req parameters
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+	if len(req.Reason) > maxImpersonationReasonLength {
+		respondWithError(w, http.StatusBadRequest, "Reason is too long")
+		return
+	}
+	if admin.Subject == req.UserID.String() {
+		respondWithError(w, http.StatusBadRequest, "Can't impersonate yourself")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), req.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find the user")
+		return
+	}
+
+	// Admins acting as each other would blur who did what.
+	if auth.Role(user.Role).AtLeast(auth.RoleAdmin) {
+		respondWithError(w, http.StatusForbidden, "Admins can't be impersonated")
+		return
+	}
+
+	token := accessTokenFor(user, uuid.Nil)
+	token.ActorID = uuid.MustParse(admin.Subject)
+	accessToken, err := cfg.signAccessToken(token, impersonationExpiration)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access token")
+		return
+	}
+
+	entry, err := cfg.db.CreateImpersonation(r.Context(), database.CreateImpersonationParams{
+		AdminID:   token.ActorID,
+		UserID:    user.ID,
+		Reason:    req.Reason,
+		TokenID:   accessToken.ID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ExpiresAt: accessToken.ExpiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record impersonation")
+		return
+	}
+	log.Printf("admin %s is impersonating user %s: %s", token.ActorID, user.ID, req.Reason)
+
+	type response struct {
+		Impersonation
+		Token string `json:"token"`
+	}
+	respondWithJSON(w, http.StatusCreated, response{
+		Impersonation: impersonationFromDB(entry),
+		Token:         accessToken.Token,
+	})
+}
+
+// listImpersonationsHandler returns the most recent entries of the audit log,
+// optionally only those for one user.
+func (cfg *apiConfig) listImpersonationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultImpersonationsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxImpersonationsLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxImpersonationsLimit))
+			return
+		}
+		limit = n
+	}
+
+	var entries []database.Impersonation
+	var err error
+	if s := r.URL.Query().Get("user_id"); s != "" {
+		userID, parseErr := uuid.Parse(s)
+		if parseErr != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		entries, err = cfg.db.GetImpersonationsByUserID(r.Context(), database.GetImpersonationsByUserIDParams{
+			UserID: userID,
+			Limit:  int32(limit),
+		})
+	} else {
+		entries, err = cfg.db.GetImpersonations(r.Context(), int32(limit))
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list impersonations")
+		return
+	}
+
+	result := make([]Impersonation, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, impersonationFromDB(e))
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
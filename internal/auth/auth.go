@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -9,74 +10,34 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 
+// HashPasword hashes password with the default hasher.
 func HashPasword(password string) (string, error) {
-	passwordByte := []byte(password)
-	generatedPassword, err := bcrypt.GenerateFromPassword(passwordByte, bcrypt.DefaultCost)
-	if err != nil {
-		return password, err
-	}
-	genPassword := string(generatedPassword)
-	return genPassword, nil
+	return DefaultPasswords.Hash(password)
 }
 
+// CheckPassword checks password against a hash made by any supported
+// hasher.
 func CheckPassword(hash, password string) error {
-	hashByte := []byte(hash)
-	passwordByte := []byte(password)
-	err := bcrypt.CompareHashAndPassword(hashByte, passwordByte)
+	_, err := DefaultPasswords.Verify(hash, password)
 	if err != nil {
 		return fmt.Errorf("password is not matching: %w", err)
 	}
 	return nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	now := time.Now().UTC()
-	claims := jwt.RegisteredClaims{
-		Issuer: "chirpy",
-		IssuedAt: jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-		Subject: userID.String(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	signedToken, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", err
-	}
-	return signedToken, nil
+// MakeJWT creates an HS256 access token for userID with role, signed with
+// tokenSecret.
+func MakeJWT(userID uuid.UUID, role Role, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return NewHMACKeySet(tokenSecret).MakeJWT(AccessToken{UserID: userID, Role: role}, expiresIn)
 }
 
-
+// ValidateJWT verifies an HS256 access token signed with tokenSecret.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	if !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
-	}
-
-	userID, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.Nil, errors.New("invalid user ID in token subject")
-	}
-
-	return userID, nil
+	return NewHMACKeySet(tokenSecret).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -104,6 +65,13 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(randomBytes), nil
 }
 
+// HashToken returns the SHA-256 digest of a random token in hex. Single-use
+// tokens are stored hashed so a database leak doesn't expose usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
     authHeader := headers.Get("Authorization")
     if authHeader == "" {
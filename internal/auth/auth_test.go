@@ -64,7 +64,7 @@ func TestMakeAndValidateJWT_Success(t *testing.T) {
 	secret := "test-secret"
 	expiresIn := time.Minute
 
-	token, err := MakeJWT(userID, secret, expiresIn)
+	token, err := MakeJWT(userID, RoleUser, secret, expiresIn)
 	if err != nil {
 		t.Fatalf("Failed to create JWT: %v", err)
 	}
@@ -84,7 +84,7 @@ func TestValidateJWT_ExpiredToken(t *testing.T) {
 	secret := "test-secret"
 	expiresIn := -1 * time.Minute // already expired
 
-	token, err := MakeJWT(userID, secret, expiresIn)
+	token, err := MakeJWT(userID, RoleUser, secret, expiresIn)
 	if err != nil {
 		t.Fatalf("Failed to create JWT: %v", err)
 	}
@@ -101,7 +101,7 @@ func TestValidateJWT_WrongSecret(t *testing.T) {
 	wrongSecret := "wrong-secret"
 	expiresIn := time.Minute
 
-	token, err := MakeJWT(userID, correctSecret, expiresIn)
+	token, err := MakeJWT(userID, RoleUser, correctSecret, expiresIn)
 	if err != nil {
 		t.Fatalf("Failed to create JWT: %v", err)
 	}
@@ -118,4 +118,22 @@ func TestValidateJWT_InvalidTokenFormat(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for malformed token, got nil")
 	}
-}
\ No newline at end of file
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	hashed := HashToken(token)
+	if hashed == token {
+		t.Error("Expected hashed token to differ from the token")
+	}
+	if hashed != HashToken(token) {
+		t.Error("Expected hashing to be deterministic")
+	}
+	if hashed == HashToken(token+"x") {
+		t.Error("Expected different tokens to hash differently")
+	}
+}
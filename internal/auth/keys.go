@@ -0,0 +1,424 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SigningKey is a key used to sign or verify JWTs. Keys loaded from a public
+// key file can only verify.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+// KeySet holds every key that is accepted when validating tokens and the one
+// key used to sign new tokens. Tokens carry the signing key's ID in the "kid"
+// header so the matching key can be found during validation.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewHMACKeySet returns a key set that signs and verifies with a shared
+// HS256 secret.
+func NewHMACKeySet(secret string) *KeySet {
+	key := &SigningKey{
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+	return &KeySet{
+		active: key,
+		keys:   map[string]*SigningKey{"": key},
+	}
+}
+
+// LoadKeySet reads every *.pem file in dir. The file name without its
+// extension is used as the key ID. Private keys (PKCS#8 or PKCS#1) can sign
+// and verify, public keys (PKIX) only verify, which is how retired keys are
+// kept around until the tokens they signed have expired. activeID selects the
+// key used for signing and must refer to a private key.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read key %s: %w", path, err)
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parseSigningKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse key %s: %w", path, err)
+		}
+		ks.keys[id] = key
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", activeID, dir)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("signing key %q has no private key", activeID)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+// AddHMACVerifier accepts tokens signed with a shared HS256 secret without
+// using it for signing. It lets tokens issued before a switch to asymmetric
+// keys stay valid until they expire.
+func (ks *KeySet) AddHMACVerifier(secret string) {
+	ks.keys[""] = &SigningKey{
+		Method: jwt.SigningMethodHS256,
+		public: []byte(secret),
+	}
+}
+
+func parseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private, public interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		public = key
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		public = &key.PublicKey
+	case ed25519.PrivateKey:
+		public = key.Public()
+	}
+
+	key := &SigningKey{ID: id, private: private, public: public}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	return key, nil
+}
+
+// Sign signs claims with the active key.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	if ks.active.ID != "" {
+		token.Header["kid"] = ks.active.ID
+	}
+	return token.SignedString(ks.active.private)
+}
+
+// Parse verifies tokenString against the key named by its "kid" header and
+// decodes it into claims.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// The algorithm must match the key, otherwise a public key could be
+		// abused as an HMAC secret.
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.public, nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+const (
+	// tokenIssuer is the "iss" of every token Chirpy signs.
+	tokenIssuer = "chirpy"
+	// AccessTokenAudience is the "aud" of access tokens. Only tokens meant
+	// for the API are accepted by it.
+	AccessTokenAudience = "chirpy-api"
+	// mfaAudience marks tokens that prove a correct password but still
+	// need a second factor before real tokens are issued.
+	mfaAudience = "chirpy-mfa"
+)
+
+// AccessToken describes who an access token is for and what it grants.
+type AccessToken struct {
+	// ID becomes the "jti" claim. A random ID is used if it is unset.
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Role          Role
+	ChirpyRed     bool
+	EmailVerified bool
+	// SessionID is the refresh token family the access token was issued
+	// with, if any, so that revoking the session can be detected.
+	SessionID uuid.UUID
+	// ClientID and Scopes are set for tokens issued to OAuth clients.
+	// Tokens without a client get every scope.
+	ClientID string
+	Scopes   []string
+	// ActorID is the admin impersonating the user, if any.
+	ActorID uuid.UUID
+}
+
+// Actor is the "act" claim of RFC 8693: who is acting on behalf of the
+// token's subject.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Claims are the claims of an access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role          Role   `json:"role,omitempty"`
+	ChirpyRed     bool   `json:"chirpy_red"`
+	EmailVerified bool   `json:"email_verified"`
+	SessionID     string `json:"sid,omitempty"`
+	// Scope is a space-separated list, as in RFC 9068.
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+// Scopes returns the scopes granted by the token.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// IsSession reports whether the token was issued to the user's own login
+// rather than to an OAuth client or an impersonating admin. Only session
+// tokens may manage the account.
+func (c *Claims) IsSession() bool {
+	return c.ClientID == "" && c.Actor == nil
+}
+
+// RequireSession returns an error describing why the token isn't a session
+// token, or nil if it is.
+func (c *Claims) RequireSession() error {
+	switch {
+	case c.ClientID != "":
+		return errors.New("tokens issued to OAuth clients can't be used here")
+	case c.Actor != nil:
+		return errors.New("impersonation tokens can't be used here")
+	}
+	return nil
+}
+
+// IsImpersonation reports whether an admin is acting as the user.
+func (c *Claims) IsImpersonation() bool {
+	return c.Actor != nil
+}
+
+// MakeJWT creates an access token described by token, signed with the
+// active key.
+func (ks *KeySet) MakeJWT(token AccessToken, expiresIn time.Duration) (string, error) {
+	scopes := token.Scopes
+	if token.ClientID == "" {
+		scopes = knownScopes
+	} else if len(scopes) == 0 {
+		return "", errors.New("client tokens need at least one scope")
+	}
+
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+
+	now := time.Now().UTC()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			ID:        token.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   token.UserID.String(),
+		},
+		Role:          token.Role,
+		ChirpyRed:     token.ChirpyRed,
+		EmailVerified: token.EmailVerified,
+		Scope:         strings.Join(scopes, " "),
+		ClientID:      token.ClientID,
+	}
+	if token.SessionID != uuid.Nil {
+		claims.SessionID = token.SessionID.String()
+	}
+	if token.ActorID != uuid.Nil {
+		claims.Actor = &Actor{Subject: token.ActorID.String()}
+	}
+	return ks.Sign(claims)
+}
+
+// ParseAccessToken verifies an access token, including its issuer and
+// audience, and returns its claims.
+func (ks *KeySet) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	err := ks.Parse(tokenString, claims,
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithAudience(AccessTokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, errors.New("invalid user ID in token subject")
+	}
+	if _, err := uuid.Parse(claims.ID); err != nil {
+		return nil, errors.New("invalid token ID")
+	}
+	if claims.Actor != nil {
+		if _, err := uuid.Parse(claims.Actor.Subject); err != nil {
+			return nil, errors.New("invalid actor in token")
+		}
+	}
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+
+	return claims, nil
+}
+
+// ValidateJWT verifies an access token from a login session and returns the
+// user it was issued to. Tokens issued to OAuth clients are rejected, since
+// their scopes don't grant everything a session may do, and so are
+// impersonation tokens.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.ParseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := claims.RequireSession(); err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.MustParse(claims.Subject), nil
+}
+
+// MakeMFAToken creates a short-lived challenge token for a user who passed
+// the password check and must now present a second factor.
+func (ks *KeySet) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		Subject:   userID.String(),
+	}
+	return ks.Sign(claims)
+}
+
+// ValidateMFAToken verifies a challenge token and returns its user.
+func (ks *KeySet) ValidateMFAToken(tokenString string) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	if err := ks.Parse(tokenString, claims, jwt.WithIssuer(tokenIssuer), jwt.WithAudience(mfaAudience)); err != nil {
+		return uuid.Nil, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid user ID in token subject")
+	}
+
+	return userID, nil
+}
+
+// JWK is the public part of a signing key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. Shared HMAC secrets are never
+// published.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
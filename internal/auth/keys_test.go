@@ -0,0 +1,363 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), data, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func writeEd25519Key(t *testing.T, dir, name string) ed25519.PublicKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	writePEM(t, dir, name, "PRIVATE KEY", der)
+	return public
+}
+
+func writeRSAKey(t *testing.T, dir, name string) *rsa.PrivateKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	writePEM(t, dir, name, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private))
+	return private
+}
+
+func TestKeySet_SignAndValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "ed-1")
+	writeRSAKey(t, dir, "rsa-1")
+
+	for _, kid := range []string{"ed-1", "rsa-1"} {
+		ks, err := LoadKeySet(dir, kid)
+		if err != nil {
+			t.Fatalf("Failed to load key set: %v", err)
+		}
+
+		userID := uuid.New()
+		token, err := ks.MakeJWT(AccessToken{UserID: userID}, time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to create JWT with %s: %v", kid, err)
+		}
+
+		parsedID, err := ks.ValidateJWT(token)
+		if err != nil {
+			t.Fatalf("Failed to validate JWT with %s: %v", kid, err)
+		}
+		if parsedID != userID {
+			t.Errorf("Expected user ID %s, got %s", userID, parsedID)
+		}
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2024-01")
+
+	oldKeys, err := LoadKeySet(dir, "2024-01")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	token, err := oldKeys.MakeJWT(AccessToken{UserID: uuid.New()}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+
+	writeEd25519Key(t, dir, "2024-02")
+	newKeys, err := LoadKeySet(dir, "2024-02")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	if _, err := newKeys.ValidateJWT(token); err != nil {
+		t.Errorf("Expected token signed with the retired key to validate, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	prunedKeys, err := LoadKeySet(dir, "2024-02")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	if _, err := prunedKeys.ValidateJWT(token); err == nil {
+		t.Error("Expected error for token signed with a removed key, got nil")
+	}
+}
+
+func TestKeySet_PublicKeyOnlyVerifies(t *testing.T) {
+	dir := t.TempDir()
+	public := writeEd25519Key(t, dir, "active")
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	writePEM(t, dir, "retired", "PUBLIC KEY", der)
+
+	if _, err := LoadKeySet(dir, "retired"); err == nil {
+		t.Error("Expected error when signing with a public key, got nil")
+	}
+}
+
+func TestKeySet_RejectsHMACWithPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "rsa-1")
+	ks, err := LoadKeySet(dir, "rsa-1")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+
+	// An HS256 token claiming the RSA key ID must not be verified with the
+	// public key bytes as the secret.
+	forger := NewHMACKeySet("rsa-1")
+	forger.active.ID = "rsa-1"
+	token, err := forger.MakeJWT(AccessToken{UserID: uuid.New()}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if _, err := ks.ValidateJWT(token); err == nil {
+		t.Error("Expected error for HS256 token, got nil")
+	}
+}
+
+func TestKeySet_HMACVerifier(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "ed-1")
+	ks, err := LoadKeySet(dir, "ed-1")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+
+	legacy, err := MakeJWT(uuid.New(), RoleUser, "legacy-secret", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if _, err := ks.ValidateJWT(legacy); err == nil {
+		t.Error("Expected error for HS256 token without a verifier, got nil")
+	}
+
+	ks.AddHMACVerifier("legacy-secret")
+	if _, err := ks.ValidateJWT(legacy); err != nil {
+		t.Errorf("Expected HS256 token to validate, got %v", err)
+	}
+	if len(ks.JWKS().Keys) != 1 {
+		t.Errorf("Expected the HMAC secret to stay out of the JWKS, got %d keys", len(ks.JWKS().Keys))
+	}
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	dir := t.TempDir()
+	edPublic := writeEd25519Key(t, dir, "ed-1")
+	writeRSAKey(t, dir, "rsa-1")
+	ks, err := LoadKeySet(dir, "ed-1")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(jwks.Keys))
+	}
+
+	ed := jwks.Keys[0]
+	if ed.Kid != "ed-1" || ed.Kty != "OKP" || ed.Alg != "EdDSA" || ed.Crv != "Ed25519" {
+		t.Errorf("Unexpected Ed25519 JWK: %+v", ed)
+	}
+	if ed.X != base64.RawURLEncoding.EncodeToString(edPublic) {
+		t.Errorf("Unexpected Ed25519 public key encoding: %q", ed.X)
+	}
+
+	rsaKey := jwks.Keys[1]
+	if rsaKey.Kid != "rsa-1" || rsaKey.Kty != "RSA" || rsaKey.Alg != "RS256" || rsaKey.E != "AQAB" {
+		t.Errorf("Unexpected RSA JWK: %+v", rsaKey)
+	}
+
+	if len(NewHMACKeySet("secret").JWKS().Keys) != 0 {
+		t.Error("Expected HMAC key set to publish no keys")
+	}
+}
+
+func TestKeySet_AccessTokenClaims(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := ks.MakeJWT(AccessToken{
+		UserID:        userID,
+		Role:          RoleModerator,
+		ChirpyRed:     true,
+		EmailVerified: true,
+		SessionID:     sessionID,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+
+	claims, err := ks.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.Issuer != "chirpy" || len(claims.Audience) != 1 || claims.Audience[0] != AccessTokenAudience {
+		t.Errorf("Unexpected issuer %q or audience %v", claims.Issuer, claims.Audience)
+	}
+	if claims.ID == "" {
+		t.Error("Expected a token ID")
+	}
+	if claims.Role != RoleModerator || !claims.ChirpyRed || !claims.EmailVerified {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	if claims.SessionID != sessionID.String() {
+		t.Errorf("Expected session ID %s, got %q", sessionID, claims.SessionID)
+	}
+	if !claims.IsSession() || len(claims.Scopes()) != len(knownScopes) {
+		t.Errorf("Expected a session token with every scope, got %v", claims.Scopes())
+	}
+
+	other, err := ks.MakeJWT(AccessToken{UserID: userID}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	otherClaims, err := ks.ParseAccessToken(other)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if otherClaims.ID == claims.ID {
+		t.Error("Expected every token to get its own ID")
+	}
+}
+
+func TestKeySet_AccessTokenID(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	tokenID := uuid.New()
+
+	token, err := ks.MakeJWT(AccessToken{ID: tokenID, UserID: uuid.New()}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	claims, err := ks.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.ID != tokenID.String() {
+		t.Errorf("Expected token ID %s, got %s", tokenID, claims.ID)
+	}
+}
+
+func TestKeySet_RejectsWrongAudienceAndIssuer(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	cases := map[string]jwt.RegisteredClaims{
+		"no audience":    {Issuer: "chirpy"},
+		"wrong audience": {Issuer: "chirpy", Audience: jwt.ClaimStrings{"other-api"}},
+		"wrong issuer":   {Issuer: "someone-else", Audience: jwt.ClaimStrings{AccessTokenAudience}},
+	}
+	for name, claims := range cases {
+		claims.Subject = uuid.NewString()
+		claims.ID = uuid.NewString()
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		token, err := ks.Sign(claims)
+		if err != nil {
+			t.Fatalf("Failed to create JWT: %v", err)
+		}
+		if _, err := ks.ValidateJWT(token); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestKeySet_ClientJWT(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	userID := uuid.New()
+
+	token, err := ks.MakeJWT(AccessToken{
+		UserID:   userID,
+		ClientID: "client-1",
+		Scopes:   []string{ScopeChirpsRead, ScopeUsersRead},
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+
+	claims, err := ks.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.ClientID != "client-1" || claims.IsSession() {
+		t.Errorf("Expected client ID client-1, got %q", claims.ClientID)
+	}
+	if scopes := claims.Scopes(); len(scopes) != 2 || scopes[0] != ScopeChirpsRead || scopes[1] != ScopeUsersRead {
+		t.Errorf("Unexpected scopes %v", scopes)
+	}
+
+	if _, err := ks.ValidateJWT(token); err == nil {
+		t.Error("Expected error when using a client token as a session token, got nil")
+	}
+
+	if _, err := ks.MakeJWT(AccessToken{UserID: userID, ClientID: "client-1"}, time.Minute); err == nil {
+		t.Error("Expected error for client token without scopes, got nil")
+	}
+}
+
+func TestKeySet_ImpersonationJWT(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	userID := uuid.New()
+	adminID := uuid.New()
+
+	token, err := ks.MakeJWT(AccessToken{UserID: userID, ActorID: adminID}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+
+	claims, err := ks.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.Subject != userID.String() {
+		t.Errorf("Expected subject %s, got %s", userID, claims.Subject)
+	}
+	if !claims.IsImpersonation() || claims.Actor.Subject != adminID.String() {
+		t.Errorf("Expected actor %s, got %+v", adminID, claims.Actor)
+	}
+	if claims.IsSession() {
+		t.Error("Expected impersonation token not to be a session token")
+	}
+
+	if _, err := ks.ValidateJWT(token); err == nil {
+		t.Error("Expected error when using an impersonation token as a session token, got nil")
+	}
+
+	session, err := ks.MakeJWT(AccessToken{UserID: userID}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	claims, err = ks.ParseAccessToken(session)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.Actor != nil {
+		t.Errorf("Expected no actor, got %+v", claims.Actor)
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long logins are blocked after repeated failures.
+// Fewer than Threshold failures block nothing. The Threshold-th failure
+// blocks logins for BaseDelay, and every failure after that doubles the
+// delay, capped at MaxDelay. Failures are forgotten once none happened for
+// Window.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// Delay returns how long to block further attempts after the given number of
+// consecutive failures: zero below Threshold, BaseDelay at Threshold.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
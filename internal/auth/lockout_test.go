@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	cases := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		// The Threshold-th failure is the first to block.
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, c := range cases {
+		if got := policy.Delay(c.failures); got != c.delay {
+			t.Errorf("After %d failures expected %s, got %s", c.failures, c.delay, got)
+		}
+	}
+}
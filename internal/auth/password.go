@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password doesn't match its hash.
+var ErrPasswordMismatch = errors.New("password is not matching")
+
+// PasswordHasher is one password hashing algorithm with fixed parameters.
+type PasswordHasher interface {
+	// Hash returns an encoded hash that includes the salt and parameters.
+	Hash(password string) (string, error)
+	// Supports reports whether hash was produced by this algorithm.
+	Supports(hash string) bool
+	// Verify checks password against a hash this hasher supports.
+	Verify(hash, password string) error
+	// NeedsRehash reports whether hash was produced with weaker parameters
+	// than the hasher's own.
+	NeedsRehash(hash string) bool
+}
+
+// BcryptMaxBytes is the longest password bcrypt can hash, in bytes.
+const BcryptMaxBytes = 72
+
+// BcryptHasher hashes with bcrypt. bcrypt only looks at the first 72 bytes
+// of a password, so longer passwords are rejected instead of truncated.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.Cost
+}
+
+// Argon2idHasher hashes with Argon2id and encodes the result in the PHC
+// string format:
+//
+//	$argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idHasher uses the parameters recommended by OWASP.
+var DefaultArgon2idHasher = Argon2idHasher{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Validate checks that h's parameters are usable. argon2.IDKey panics
+// without at least one iteration and one thread, and quietly raises memory
+// below 8 KiB per thread; salts and keys shorter than the minimums here are
+// too weak to store.
+func (h Argon2idHasher) Validate() error {
+	switch {
+	case h.Iterations < 1:
+		return errors.New("argon2id needs at least one iteration")
+	case h.Parallelism < 1:
+		return errors.New("argon2id needs a parallelism of at least 1")
+	case h.Memory < 8*uint32(h.Parallelism):
+		return fmt.Errorf("argon2id needs at least %d KiB of memory for a parallelism of %d", 8*uint32(h.Parallelism), h.Parallelism)
+	case h.SaltLength < 8:
+		return errors.New("argon2id salts must be at least 8 bytes long")
+	case h.KeyLength < 16:
+		return errors.New("argon2id keys must be at least 16 bytes long")
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("couldn't generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) Verify(hash, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.Memory ||
+		params.Iterations < h.Iterations ||
+		params.Parallelism < h.Parallelism ||
+		uint32(len(key)) < h.KeyLength
+}
+
+func decodeArgon2id(hash string) (params Argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	// A damaged hash must not make argon2.IDKey panic.
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	if err := params.Validate(); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	return params, salt, key, nil
+}
+
+// Passwords hashes new passwords with one hasher and verifies hashes made by
+// any supported algorithm, so stored hashes can be upgraded gradually.
+type Passwords struct {
+	current PasswordHasher
+	known   []PasswordHasher
+	dummy   func() dummyHash
+}
+
+// dummyHash is what VerifyDummy checks passwords against.
+type dummyHash struct {
+	hasher PasswordHasher
+	hash   string
+}
+
+const dummyPassword = "chirpy-dummy-password"
+
+// NewPasswords returns Passwords that hash with current. Argon2id and bcrypt
+// hashes are always accepted for verification.
+func NewPasswords(current PasswordHasher) *Passwords {
+	p := &Passwords{
+		current: current,
+		known:   []PasswordHasher{current, DefaultArgon2idHasher, BcryptHasher{Cost: bcrypt.DefaultCost}},
+	}
+	p.dummy = sync.OnceValue(p.slowestDummy)
+	return p
+}
+
+// DefaultPasswords hashes with DefaultArgon2idHasher.
+var DefaultPasswords = NewPasswords(DefaultArgon2idHasher)
+
+// Hash hashes password with the current hasher.
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.current.Hash(password)
+}
+
+// Verify checks password against hash. On success it also reports whether
+// the hash should be replaced by a new one from Hash, because it uses an
+// older algorithm or weaker parameters.
+func (p *Passwords) Verify(hash, password string) (needsRehash bool, err error) {
+	for _, h := range p.known {
+		if !h.Supports(hash) {
+			continue
+		}
+		if err := h.Verify(hash, password); err != nil {
+			return false, err
+		}
+		return !p.current.Supports(hash) || p.current.NeedsRehash(hash), nil
+	}
+	return false, errors.New("unsupported password hash")
+}
+
+// VerifyDummy does the work of Verify without a stored hash, so that a login
+// for an unknown account takes as long as one with a wrong password. It
+// always fails.
+//
+// It takes as long as the slowest hasher Verify knows. While some stored
+// hashes still use a faster one, such as bcrypt after switching to Argon2id,
+// logins to those accounts fail faster than for unknown accounts; the timing
+// only matches for every account once all hashes have been replaced.
+func (p *Passwords) VerifyDummy(password string) error {
+	dummy := p.dummy()
+	dummy.hasher.Verify(dummy.hash, password)
+	return ErrPasswordMismatch
+}
+
+// slowestDummy hashes a dummy password with every known hasher and keeps
+// the hash that took longest to verify.
+func (p *Passwords) slowestDummy() dummyHash {
+	slowest := dummyHash{hasher: p.current}
+	var slowestTime time.Duration
+	for _, h := range p.known {
+		hash, err := h.Hash(dummyPassword)
+		if err != nil {
+			continue
+		}
+		start := time.Now()
+		h.Verify(hash, dummyPassword)
+		if elapsed := time.Since(start); elapsed > slowestTime {
+			slowest, slowestTime = dummyHash{hasher: h, hash: hash}, elapsed
+		}
+	}
+	return slowest
+}
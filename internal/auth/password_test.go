@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idHasher = Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher_PHCFormat(t *testing.T) {
+	hash, err := testArgon2idHasher.Hash("MySecurePassword123")
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+	if len(strings.Split(hash, "$")) != 6 {
+		t.Errorf("Expected six $-separated fields, got %s", hash)
+	}
+}
+
+func TestArgon2idHasher_Verify(t *testing.T) {
+	hash, err := testArgon2idHasher.Hash("CorrectPassword")
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+
+	if err := testArgon2idHasher.Verify(hash, "CorrectPassword"); err != nil {
+		t.Errorf("Expected password to match, got %v", err)
+	}
+	if err := testArgon2idHasher.Verify(hash, "WrongPassword"); err != ErrPasswordMismatch {
+		t.Errorf("Expected ErrPasswordMismatch, got %v", err)
+	}
+}
+
+func TestArgon2idHasher_LongPassword(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	hash, err := testArgon2idHasher.Hash(long)
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+	if err := testArgon2idHasher.Verify(hash, long[:72]); err == nil {
+		t.Error("Expected a 72-byte prefix not to match a longer password")
+	}
+}
+
+func TestArgon2idHasher_Validate(t *testing.T) {
+	if err := DefaultArgon2idHasher.Validate(); err != nil {
+		t.Errorf("Expected the default parameters to be valid, got %v", err)
+	}
+
+	invalid := map[string]func(h *Argon2idHasher){
+		"no iterations":  func(h *Argon2idHasher) { h.Iterations = 0 },
+		"no parallelism": func(h *Argon2idHasher) { h.Parallelism = 0 },
+		"too little memory": func(h *Argon2idHasher) {
+			h.Memory = 31
+			h.Parallelism = 4
+		},
+		"short salt": func(h *Argon2idHasher) { h.SaltLength = 4 },
+		"short key":  func(h *Argon2idHasher) { h.KeyLength = 8 },
+	}
+	for name, change := range invalid {
+		h := DefaultArgon2idHasher
+		change(&h)
+		if err := h.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestArgon2idHasher_VerifyRejectsZeroIterations(t *testing.T) {
+	hash, err := testArgon2idHasher.Hash("CorrectPassword")
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+	damaged := strings.Replace(hash, ",t=1,", ",t=0,", 1)
+	if err := testArgon2idHasher.Verify(damaged, "CorrectPassword"); err == nil {
+		t.Error("Expected a hash with zero iterations to be rejected")
+	}
+}
+
+func TestBcryptHasher_RejectsLongPassword(t *testing.T) {
+	if _, err := (BcryptHasher{Cost: bcrypt.MinCost}).Hash(strings.Repeat("a", 73)); err == nil {
+		t.Error("Expected error for password over 72 bytes, got nil")
+	}
+}
+
+func TestPasswords_RehashFromBcrypt(t *testing.T) {
+	bcryptHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("OldPassword")
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+
+	passwords := NewPasswords(testArgon2idHasher)
+	needsRehash, err := passwords.Verify(bcryptHash, "OldPassword")
+	if err != nil {
+		t.Fatalf("Expected bcrypt hash to verify, got %v", err)
+	}
+	if !needsRehash {
+		t.Error("Expected bcrypt hash to need a rehash")
+	}
+
+	if _, err := passwords.Verify(bcryptHash, "WrongPassword"); err == nil {
+		t.Error("Expected error for wrong password, got nil")
+	}
+}
+
+func TestPasswords_RehashWeakerParameters(t *testing.T) {
+	weak, err := testArgon2idHasher.Hash("Password")
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+
+	stronger := testArgon2idHasher
+	stronger.Iterations = 2
+	needsRehash, err := NewPasswords(stronger).Verify(weak, "Password")
+	if err != nil {
+		t.Fatalf("Expected hash to verify, got %v", err)
+	}
+	if !needsRehash {
+		t.Error("Expected hash with fewer iterations to need a rehash")
+	}
+
+	needsRehash, err = NewPasswords(testArgon2idHasher).Verify(weak, "Password")
+	if err != nil {
+		t.Fatalf("Expected hash to verify, got %v", err)
+	}
+	if needsRehash {
+		t.Error("Expected hash with current parameters not to need a rehash")
+	}
+}
+
+func TestPasswords_BcryptCost(t *testing.T) {
+	hash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("Password")
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+
+	needsRehash, err := NewPasswords(BcryptHasher{Cost: bcrypt.MinCost + 1}).Verify(hash, "Password")
+	if err != nil {
+		t.Fatalf("Expected hash to verify, got %v", err)
+	}
+	if !needsRehash {
+		t.Error("Expected hash with lower cost to need a rehash")
+	}
+}
+
+func TestPasswords_VerifyDummy(t *testing.T) {
+	if err := NewPasswords(testArgon2idHasher).VerifyDummy("chirpy-dummy-password"); err == nil {
+		t.Error("Expected dummy check to fail, got nil")
+	}
+}
+
+func TestPasswords_DummyUsesAKnownHasher(t *testing.T) {
+	passwords := NewPasswords(testArgon2idHasher)
+	dummy := passwords.dummy()
+	if !dummy.hasher.Supports(dummy.hash) {
+		t.Fatalf("Expected the dummy hash to belong to its hasher, got %q", dummy.hash)
+	}
+	if err := dummy.hasher.Verify(dummy.hash, dummyPassword); err != nil {
+		t.Errorf("Expected the dummy hash to verify, got %v", err)
+	}
+}
+
+func TestPasswords_UnsupportedHash(t *testing.T) {
+	if _, err := DefaultPasswords.Verify("plaintext", "plaintext"); err == nil {
+		t.Error("Expected error for unsupported hash, got nil")
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// Example from RFC 7636, appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	expected := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := PKCEChallenge(verifier); got != expected {
+		t.Errorf("Expected challenge %s, got %s", expected, got)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := PKCEChallenge(verifier)
+
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("Expected matching verifier to pass")
+	}
+	if VerifyPKCE(strings.Replace(verifier, "d", "e", 1), challenge) {
+		t.Error("Expected different verifier to fail")
+	}
+
+	short := "abc"
+	if VerifyPKCE(short, PKCEChallenge(short)) {
+		t.Error("Expected too short verifier to fail")
+	}
+	invalid := strings.Repeat("a", 42) + "/"
+	if VerifyPKCE(invalid, PKCEChallenge(invalid)) {
+		t.Error("Expected verifier with reserved characters to fail")
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords holds well-known and breached passwords, lowercased.
+var commonPasswords = func() map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// PasswordPolicy lists the rules a new password has to satisfy. Lengths are
+// counted in characters, not bytes, except for MaxBytes.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	RejectEmail   bool
+	RejectCommon  bool
+	// MaxBytes is the most bytes the password hasher accepts, if it has a
+	// limit. See ForHasher.
+	MaxBytes int
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: a minimum length and a
+// blocklist rather than composition rules.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	MaxLength:    128,
+	RejectEmail:  true,
+	RejectCommon: true,
+}
+
+// ForHasher returns p limited to the passwords h can hash: bcrypt takes at
+// most BcryptMaxBytes, which MaxLength characters can easily exceed.
+func (p PasswordPolicy) ForHasher(h PasswordHasher) PasswordPolicy {
+	if _, ok := h.(BcryptHasher); ok {
+		p.MaxBytes = BcryptMaxBytes
+	}
+	return p
+}
+
+// PolicyViolation names a rule a password broke. Rule is stable and meant
+// for clients; Message is for people.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Validate returns every rule password breaks, or nil if it is acceptable.
+// emails are the addresses of the account, which the password must not
+// repeat.
+func (p PasswordPolicy) Validate(password string, emails ...string) []PolicyViolation {
+	var violations []PolicyViolation
+	add := func(rule, message string) {
+		violations = append(violations, PolicyViolation{Rule: rule, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add("min_length", fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	switch {
+	case p.MaxLength > 0 && length > p.MaxLength:
+		add("max_length", fmt.Sprintf("Password must be at most %d characters long", p.MaxLength))
+	case p.MaxBytes > 0 && len(password) > p.MaxBytes:
+		add("max_length", fmt.Sprintf("Password must be at most %d bytes long; characters outside ASCII take two to four bytes each", p.MaxBytes))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		add("require_upper", "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add("require_lower", "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add("require_digit", "Password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add("require_symbol", "Password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.RejectEmail {
+		for _, email := range emails {
+			email = strings.ToLower(strings.TrimSpace(email))
+			local, _, _ := strings.Cut(email, "@")
+			if email != "" && (lowered == email || lowered == local) {
+				add("not_email", "Password must not be the same as the email address")
+				break
+			}
+		}
+	}
+
+	if p.RejectCommon {
+		if _, ok := commonPasswords[lowered]; ok {
+			add("not_common", "Password is too common")
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func violatedRules(violations []PolicyViolation) []string {
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:     10,
+		MaxLength:     20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		RejectEmail:   true,
+		RejectCommon:  true,
+	}
+
+	cases := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		emails   []string
+		rules    []string
+	}{
+		{"acceptable", DefaultPasswordPolicy, "correct horse battery", []string{"user@example.com"}, []string{}},
+		{"empty", DefaultPasswordPolicy, "", nil, []string{"min_length"}},
+		{"too long", DefaultPasswordPolicy, strings.Repeat("x", 129), nil, []string{"max_length"}},
+		{"multibyte counts characters", PasswordPolicy{MinLength: 4}, "äöüß", nil, []string{}},
+		{"too many bytes", PasswordPolicy{MaxLength: 128, MaxBytes: 72}, strings.Repeat("ä", 40), nil, []string{"max_length"}},
+		{"too long and too many bytes", PasswordPolicy{MaxLength: 20, MaxBytes: 72}, strings.Repeat("ä", 40), nil, []string{"max_length"}},
+		{"within bytes", PasswordPolicy{MaxLength: 128, MaxBytes: 72}, strings.Repeat("x", 72), nil, []string{}},
+		{"email", DefaultPasswordPolicy, "User@Example.com", []string{"user@example.com"}, []string{"not_email"}},
+		{"email local part", DefaultPasswordPolicy, "someuser", []string{"someuser@example.com"}, []string{"not_email"}},
+		{"common", DefaultPasswordPolicy, "Password123", nil, []string{"not_common"}},
+		{"composition", strict, "aaaaaaaaaaaa", nil, []string{"require_upper", "require_digit", "require_symbol"}},
+		{"strict acceptable", strict, "Tr0ub4dor&3x", nil, []string{}},
+	}
+
+	for _, c := range cases {
+		got := violatedRules(c.policy.Validate(c.password, c.emails...))
+		if strings.Join(got, ",") != strings.Join(c.rules, ",") {
+			t.Errorf("%s: expected %v, got %v", c.name, c.rules, got)
+		}
+	}
+}
+
+func TestPasswordPolicy_ForHasher(t *testing.T) {
+	if got := DefaultPasswordPolicy.ForHasher(DefaultArgon2idHasher).MaxBytes; got != 0 {
+		t.Errorf("Expected no byte limit for argon2id, got %d", got)
+	}
+
+	policy := DefaultPasswordPolicy.ForHasher(BcryptHasher{Cost: 10})
+	if policy.MaxBytes != BcryptMaxBytes {
+		t.Errorf("Expected a byte limit of %d for bcrypt, got %d", BcryptMaxBytes, policy.MaxBytes)
+	}
+	// Every password the policy accepts must be one bcrypt can hash.
+	password := strings.Repeat("€", 30)
+	rules := violatedRules(policy.Validate(password))
+	if strings.Join(rules, ",") != "max_length" {
+		t.Errorf("Expected max_length for a %d-byte password, got %v", len(password), rules)
+	}
+}
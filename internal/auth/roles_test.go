@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestRole_AtLeast(t *testing.T) {
+	cases := []struct {
+		role Role
+		min  Role
+		want bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{Role("superuser"), RoleUser, false},
+	}
+	for _, c := range cases {
+		if got := c.role.AtLeast(c.min); got != c.want {
+			t.Errorf("Expected %s.AtLeast(%s) to be %v, got %v", c.role, c.min, c.want, got)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	if role, err := ParseRole("moderator"); err != nil || role != RoleModerator {
+		t.Errorf("Expected moderator, got %q, %v", role, err)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Error("Expected error for unknown role, got nil")
+	}
+}
+
+func TestParseAccessToken_Role(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	userID := uuid.New()
+
+	token, err := ks.MakeJWT(AccessToken{UserID: userID, Role: RoleAdmin}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	claims, err := ks.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.Role != RoleAdmin {
+		t.Errorf("Expected role %s, got %s", RoleAdmin, claims.Role)
+	}
+
+	// Tokens issued before roles existed carry no role claim.
+	legacy, err := ks.Sign(jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Audience:  jwt.ClaimStrings{AccessTokenAudience},
+		ID:        uuid.NewString(),
+		Subject:   userID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	claims, err = ks.ParseAccessToken(legacy)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT: %v", err)
+	}
+	if claims.Role != RoleUser {
+		t.Errorf("Expected role %s, got %s", RoleUser, claims.Role)
+	}
+}
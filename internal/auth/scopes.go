@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a token that isn't a full login session may do.
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUsersRead   = "users:read"
+)
+
+var knownScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersRead}
+
+// AllScopes returns every scope, which is what a login session is granted.
+func AllScopes() []string {
+	return slices.Clone(knownScopes)
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can
+// be told apart from JWTs and found by secret scanners.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a new random personal access token.
+func MakePersonalAccessToken() (string, error) {
+	random, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + random, nil
+}
+
+// IsPersonalAccessToken reports whether token looks like a personal access
+// token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// ParseScopes checks that every scope is known and returns them sorted and
+// without duplicates.
+func ParseScopes(scopes []string) ([]string, error) {
+	parsed := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(knownScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		parsed = append(parsed, scope)
+	}
+	slices.Sort(parsed)
+	return slices.Compact(parsed), nil
+}
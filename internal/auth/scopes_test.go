@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite})
+	if err != nil {
+		t.Fatalf("Failed to parse scopes: %v", err)
+	}
+	expected := []string{ScopeChirpsRead, ScopeChirpsWrite}
+	if !slices.Equal(scopes, expected) {
+		t.Errorf("Expected %v, got %v", expected, scopes)
+	}
+
+	if _, err := ParseScopes([]string{"chirps:admin"}); err == nil {
+		t.Error("Expected error for unknown scope, got nil")
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("Expected %q to be recognized as a personal access token", token)
+	}
+
+	accessToken, err := MakeJWT(uuid.New(), RoleUser, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if IsPersonalAccessToken(accessToken) {
+		t.Error("Expected JWT not to be recognized as a personal access token")
+	}
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Test vectors from RFC 6238 appendix B, truncated to six digits.
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, c := range cases {
+		code, err := TOTPCode(secret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatalf("Failed to compute code: %v", err)
+		}
+		if code != c.code {
+			t.Errorf("At %d expected %s, got %s", c.unix, c.code, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+	now := time.Now()
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("Failed to compute code: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, code, now, 0); !ok {
+		t.Error("Expected current code to be valid")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(30*time.Second), 0); !ok {
+		t.Error("Expected code from the previous period to be valid")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(5*time.Minute), 0); ok {
+		t.Error("Expected old code to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("Expected short code to be rejected")
+	}
+}
+
+func TestValidateTOTP_Replay(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+	now := time.Now()
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("Failed to compute code: %v", err)
+	}
+	step, ok := ValidateTOTP(secret, code, now, 0)
+	if !ok {
+		t.Fatal("Expected current code to be valid")
+	}
+	if want := now.Unix() / totpPeriod; step != want {
+		t.Errorf("Expected step %d, got %d", want, step)
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Error("Expected a used code to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(30*time.Second), step); ok {
+		t.Error("Expected a used code to be rejected in the next period")
+	}
+
+	next, err := TOTPCode(secret, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("Failed to compute code: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, next, now, step); !ok {
+		t.Error("Expected the code for the next step to be valid")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "user@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") {
+		t.Errorf("Unexpected URI prefix: %s", uri)
+	}
+	for _, want := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=Chirpy", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("Expected URI to contain %q, got %s", want, uri)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Failed to generate codes: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected code format: %q", code)
+		}
+		if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Errorf("Expected normalized input to match %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	ks := NewHMACKeySet("test-secret")
+	userID := uuid.New()
+
+	mfaToken, err := ks.MakeMFAToken(userID, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create MFA token: %v", err)
+	}
+	if _, err := ks.ValidateJWT(mfaToken); err == nil {
+		t.Error("Expected MFA token to be rejected as an access token")
+	}
+
+	parsedID, err := ks.ValidateMFAToken(mfaToken)
+	if err != nil {
+		t.Fatalf("Failed to validate MFA token: %v", err)
+	}
+	if parsedID != userID {
+		t.Errorf("Expected user ID %s, got %s", userID, parsedID)
+	}
+
+	accessToken, err := ks.MakeJWT(AccessToken{UserID: userID}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if _, err := ks.ValidateMFAToken(accessToken); err == nil {
+		t.Error("Expected access token to be rejected as an MFA token")
+	}
+}
@@ -7,23 +7,151 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpReplies = `-- name: CountChirpReplies :many
+SELECT reply_to_id::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE
+    reply_to_id = ANY($1::uuid[])
+    AND deleted_at IS NULL
+GROUP BY reply_to_id
+`
+
+type CountChirpRepliesRow struct {
+	ChirpID    uuid.UUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountChirpReplies(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpReplies, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRepliesRow
+	for rows.Next() {
+		var i CountChirpRepliesRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countChirpReposts = `-- name: CountChirpReposts :many
+SELECT
+    quoted_chirp_id::uuid AS chirp_id,
+    COUNT(*) FILTER (WHERE kind = 'rechirp') AS rechirp_count,
+    COUNT(*) FILTER (WHERE kind = 'quote') AS quote_count
+FROM chirps
+WHERE
+    quoted_chirp_id = ANY($1::uuid[])
+    AND deleted_at IS NULL
+GROUP BY quoted_chirp_id
+`
+
+type CountChirpRepostsRow struct {
+	ChirpID      uuid.UUID
+	RechirpCount int64
+	QuoteCount   int64
+}
+
+func (q *Queries) CountChirpReposts(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRepostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpReposts, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRepostsRow
+	for rows.Next() {
+		var i CountChirpRepostsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.RechirpCount,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChrips = `-- name: CreateChrips :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
-VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, reply_to_id, kind, quoted_chirp_id)
+VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
+RETURNING id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id
 `
 
 type CreateChripsParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body          string
+	UserID        uuid.UUID
+	ReplyToID     uuid.NullUUID
+	Kind          string
+	QuotedChirpID uuid.NullUUID
 }
 
 func (q *Queries) CreateChrips(ctx context.Context, arg CreateChripsParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChrips, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChrips,
+		arg.Body,
+		arg.UserID,
+		arg.ReplyToID,
+		arg.Kind,
+		arg.QuotedChirpID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, kind, quoted_chirp_id)
+VALUES(gen_random_uuid(), NOW(), NOW(), '', $1, 'rechirp', $2)
+ON CONFLICT (user_id, quoted_chirp_id) WHERE kind = 'rechirp' AND deleted_at IS NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id
+`
+
+type CreateRechirpParams struct {
+	UserID        uuid.UUID
+	QuotedChirpID uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.QuotedChirpID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,27 +159,61 @@ func (q *Queries) CreateChrips(ctx context.Context, arg CreateChripsParams) (Chi
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
 	)
 	return i, err
 }
 
-const deleteChirpsByID = `-- name: DeleteChirpsByID :exec
+const deleteRechirp = `-- name: DeleteRechirp :execrows
 DELETE FROM chirps
-WHERE id = $1
+WHERE
+    user_id = $1
+    AND quoted_chirp_id = $2
+    AND kind = 'rechirp'
 `
 
-func (q *Queries) DeleteChirpsByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirpsByID, id)
-	return err
+type DeleteRechirpParams struct {
+	UserID        uuid.UUID
+	QuotedChirpID uuid.NullUUID
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.QuotedChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT reply_to_id AS id, 1 AS depth
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT chirps.reply_to_id, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+    WHERE ancestors.depth < $2
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.edited_at, chirps.deleted_at, chirps.reply_to_id, chirps.kind, chirps.quoted_chirp_id FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+WHERE chirps.deleted_at IS NULL
+ORDER BY ancestors.depth DESC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpAncestorsParams struct {
+	ID       uuid.UUID
+	MaxDepth int32
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ID, arg.MaxDepth)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +227,12 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
 		); err != nil {
 			return nil, err
 		}
@@ -79,14 +247,32 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsByAuthorID = `-- name: GetChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, 1 AS depth
+    FROM chirps
+    WHERE reply_to_id = $1::uuid
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.reply_to_id = descendants.id
+    WHERE descendants.depth < $2
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.edited_at, chirps.deleted_at, chirps.reply_to_id, chirps.kind, chirps.quoted_chirp_id FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE chirps.deleted_at IS NULL
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT $3
 `
 
-func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorID, userID)
+type GetChirpDescendantsParams struct {
+	ID       uuid.UUID
+	MaxDepth int32
+	Limit    int32
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, arg.ID, arg.MaxDepth, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +286,12 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
 		); err != nil {
 			return nil, err
 		}
@@ -114,11 +306,71 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 	return items, nil
 }
 
-const getChirpsByID = `-- name: GetChirpsByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
+	)
+	return i, err
+}
+
+const getChirpIncludingDeleted = `-- name: GetChirpIncludingDeleted :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
 WHERE id = $1
 `
 
+func (q *Queries) GetChirpIncludingDeleted(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpIncludingDeleted, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
+	)
+	return i, err
+}
+
+const getChirpsByID = `-- name: GetChirpsByID :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+    AND (
+        kind <> 'rechirp'
+        OR EXISTS (
+            SELECT 1 FROM chirps AS original
+            WHERE original.id = chirps.quoted_chirp_id AND original.deleted_at IS NULL
+        )
+    )
+`
+
 func (q *Queries) GetChirpsByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	row := q.db.QueryRowContext(ctx, getChirpsByID, id)
 	var i Chirp
@@ -128,6 +380,460 @@ func (q *Queries) GetChirpsByID(ctx context.Context, id uuid.UUID) (Chirp, error
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
+	)
+	return i, err
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
+WHERE
+    id = ANY($1::uuid[])
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
+WHERE
+    reply_to_id = $1::uuid
+    AND deleted_at IS NULL
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) > ($2, $3::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpRepliesParams struct {
+	ReplyToID      uuid.UUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ReplyToID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirps = `-- name: ListChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
+WHERE
+    deleted_at IS NULL
+    AND (
+        kind <> 'rechirp'
+        OR EXISTS (
+            SELECT 1 FROM chirps AS original
+            WHERE original.id = chirps.quoted_chirp_id AND original.deleted_at IS NULL
+        )
+    )
+    AND ($1::uuid IS NULL OR user_id = $1)
+    AND ($2::timestamp IS NULL OR created_at >= $2)
+    AND ($3::timestamp IS NULL OR created_at < $3)
+    AND (
+        $4::timestamp IS NULL
+        OR (created_at, id) > ($4, $5::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT $6
+`
+
+type ListChirpsParams struct {
+	AuthorID       uuid.NullUUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id FROM chirps
+WHERE
+    deleted_at IS NULL
+    AND (
+        kind <> 'rechirp'
+        OR EXISTS (
+            SELECT 1 FROM chirps AS original
+            WHERE original.id = chirps.quoted_chirp_id AND original.deleted_at IS NULL
+        )
+    )
+    AND ($1::uuid IS NULL OR user_id = $1)
+    AND ($2::timestamp IS NULL OR created_at >= $2)
+    AND ($3::timestamp IS NULL OR created_at < $3)
+    AND (
+        $4::timestamp IS NULL
+        OR (created_at, id) < ($4, $5::uuid)
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT $6
+`
+
+type ListChirpsDescParams struct {
+	AuthorID       uuid.NullUUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE
+    id = $1
+    AND user_id = $2
+    AND deleted_at > $3
+RETURNING id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id
+`
+
+type RestoreChirpParams struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	DeletedAt sql.NullTime
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.UserID, arg.DeletedAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
+	)
+	return i, err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+WITH matches AS (
+    SELECT
+        chirps.id,
+        chirps.created_at,
+        chirps.updated_at,
+        chirps.body,
+        chirps.user_id,
+        chirps.edited_at,
+        chirps.reply_to_id,
+        chirps.kind,
+        chirps.quoted_chirp_id,
+        ts_rank(chirps.search_vector, query) AS rank,
+        query
+    FROM chirps, to_tsquery('english', $1) AS query
+    WHERE
+        chirps.search_vector @@ query
+        AND chirps.deleted_at IS NULL
+        AND ($2::uuid IS NULL OR chirps.user_id = $2)
+)
+SELECT
+    id,
+    created_at,
+    updated_at,
+    body,
+    user_id,
+    edited_at,
+    reply_to_id,
+    kind,
+    quoted_chirp_id,
+    rank,
+    ts_headline('english', body, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20')::text AS headline
+FROM matches
+WHERE
+    $3::real IS NULL
+    OR (rank, created_at, id) < ($3, $4::timestamp, $5::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $6
+`
+
+type SearchChirpsParams struct {
+	Query          string
+	AuthorID       uuid.NullUUID
+	AfterRank      sql.NullFloat64
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+type SearchChirpsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.UUID
+	EditedAt      sql.NullTime
+	ReplyToID     uuid.NullUUID
+	Kind          string
+	QuotedChirpID uuid.NullUUID
+	Rank          float32
+	Headline      string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.AfterRank,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ReplyToID,
+			&i.Kind,
+			&i.QuotedChirpID,
+			&i.Rank,
+			&i.Headline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	return err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET
+    body = $2,
+    updated_at = NOW(),
+    edited_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search_vector, edited_at, deleted_at, reply_to_id, kind, quoted_chirp_id
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyToID,
+		&i.Kind,
+		&i.QuotedChirpID,
 	)
 	return i, err
 }
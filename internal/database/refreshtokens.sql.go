@@ -7,25 +7,45 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createToken = `-- name: CreateToken :one
-INSERT INTO refreshtokens(token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+INSERT INTO refreshtokens(token, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip_address, last_used_at, client_id, scopes, access_token_id, access_token_expires_at)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, NOW(), $7, $8, $9, $10)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, user_agent, ip_address, last_used_at, client_id, scopes, access_token_id, access_token_expires_at
 `
 
 type CreateTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
+	Token                string
+	UserID               uuid.UUID
+	ExpiresAt            time.Time
+	FamilyID             uuid.UUID
+	UserAgent            string
+	IpAddress            string
+	ClientID             uuid.NullUUID
+	Scopes               []string
+	AccessTokenID        uuid.NullUUID
+	AccessTokenExpiresAt sql.NullTime
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Refreshtoken, error) {
-	row := q.db.QueryRowContext(ctx, createToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+		arg.AccessTokenID,
+		arg.AccessTokenExpiresAt,
+	)
 	var i Refreshtoken
 	err := row.Scan(
 		&i.Token,
@@ -34,12 +54,69 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Refre
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.AccessTokenID,
+		&i.AccessTokenExpiresAt,
 	)
 	return i, err
 }
 
+const getActiveSessionsByUserID = `-- name: GetActiveSessionsByUserID :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, user_agent, ip_address, last_used_at, client_id, scopes, access_token_id, access_token_expires_at FROM refreshtokens
+WHERE
+    user_id = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+ORDER BY last_used_at DESC
+`
+
+func (q *Queries) GetActiveSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]Refreshtoken, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveSessionsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Refreshtoken
+	for rows.Next() {
+		var i Refreshtoken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.FamilyID,
+			&i.ReplacedBy,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.LastUsedAt,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+			&i.AccessTokenID,
+			&i.AccessTokenExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserToken = `-- name: GetUserToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refreshtokens
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, user_agent, ip_address, last_used_at, client_id, scopes, access_token_id, access_token_expires_at FROM refreshtokens
 WHERE token = $1
 `
 
@@ -53,10 +130,72 @@ func (q *Queries) GetUserToken(ctx context.Context, token string) (Refreshtoken,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.AccessTokenID,
+		&i.AccessTokenExpiresAt,
 	)
 	return i, err
 }
 
+const isSessionActive = `-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refreshtokens
+    WHERE
+        family_id = $1
+        AND revoked_at IS NULL
+        AND expires_at > NOW()
+)
+`
+
+func (q *Queries) IsSessionActive(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isSessionActive, familyID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const revokeAllUserTokens = `-- name: RevokeAllUserTokens :exec
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllUserTokens, userID)
+	return err
+}
+
+const revokeOtherUserTokens = `-- name: RevokeOtherUserTokens :exec
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND family_id <> $2
+    AND revoked_at IS NULL
+`
+
+type RevokeOtherUserTokensParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherUserTokens(ctx context.Context, arg RevokeOtherUserTokensParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOtherUserTokens, arg.UserID, arg.FamilyID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refreshtokens
 SET revoked_at = NOW() -- Or $2 if you want to pass the timestamp from Go
@@ -67,3 +206,66 @@ func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
 	return err
 }
+
+const revokeTokenFamily = `-- name: RevokeTokenFamily :exec
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeTokenFamily, familyID)
+	return err
+}
+
+const revokeUserTokenFamily = `-- name: RevokeUserTokenFamily :execrows
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL
+`
+
+type RevokeUserTokenFamilyParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeUserTokenFamily(ctx context.Context, arg RevokeUserTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserTokenFamily, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW(),
+    replaced_by = $2
+WHERE
+    token = $1
+    AND revoked_at IS NULL
+`
+
+type RotateRefreshTokenParams struct {
+	Token      string
+	ReplacedBy sql.NullString
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateRefreshToken, arg.Token, arg.ReplacedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,127 @@
+// Package hashtags finds #hashtags in chirp bodies, in any script.
+package hashtags
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest hashtag recognized, in characters and without
+// the hash sign. Longer ones are ignored rather than cut short.
+const MaxLength = 100
+
+var ErrInvalidHashtag = errors.New("not a valid hashtag")
+
+// Hashtag is a hashtag found in a text.
+type Hashtag struct {
+	// Tag is the normalized hashtag, without the hash sign. Hashtags that
+	// only differ in case or in how their characters are encoded, such as an
+	// accented letter typed as one code point or two, have the same Tag.
+	Tag string
+	// Start and End are the offsets of the hashtag, hash sign included, in
+	// characters (Unicode code points) rather than bytes. End is exclusive.
+	Start, End int
+}
+
+// isHash reports whether r starts a hashtag. The fullwidth number sign is
+// what CJK keyboards type.
+func isHash(r rune) bool {
+	return r == '#' || r == '＃'
+}
+
+// isTagRune reports whether r can be part of a hashtag. Marks are needed for
+// scripts such as Devanagari, the zero-width joiners for Persian and some
+// Indic scripts.
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) ||
+		r == '_' || r == '\u200c' || r == '\u200d'
+}
+
+// valid reports whether tag, without its hash sign, is a hashtag: at most
+// MaxLength characters that can be part of one, at least one a letter, so
+// that "#1" stays a number.
+func valid(tag []rune) bool {
+	if len(tag) == 0 || len(tag) > MaxLength {
+		return false
+	}
+	for _, r := range tag {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract returns the hashtags in text in the order they appear. A hashtag
+// is a hash sign followed by letters, digits, marks and underscores. It
+// must not follow one of those, or "&", so that "a#b" and "&#39;" aren't
+// hashtags, nor be followed by another hash sign.
+func Extract(text string) []Hashtag {
+	runes := []rune(text)
+	var found []Hashtag
+	for i := 0; i < len(runes); i++ {
+		if !isHash(runes[i]) {
+			continue
+		}
+		if i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '&' || isHash(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+		// "#a#b" is more likely noise than two hashtags.
+		if end < len(runes) && isHash(runes[end]) {
+			i = end
+			continue
+		}
+		tag := runes[i+1 : end]
+		if valid(tag) {
+			found = append(found, Hashtag{Tag: normalize(tag), Start: i, End: end})
+		}
+		i = end - 1
+	}
+	return found
+}
+
+// Tags returns the distinct tags of hashtags, in the order they first
+// appear.
+func Tags(hashtags []Hashtag) []string {
+	seen := make(map[string]bool, len(hashtags))
+	tags := make([]string, 0, len(hashtags))
+	for _, h := range hashtags {
+		if !seen[h.Tag] {
+			seen[h.Tag] = true
+			tags = append(tags, h.Tag)
+		}
+	}
+	return tags
+}
+
+// Normalize returns the tag of a hashtag given with or without its hash
+// sign, such as one typed into a search.
+func Normalize(hashtag string) (string, error) {
+	if r, size := utf8.DecodeRuneInString(hashtag); isHash(r) {
+		hashtag = hashtag[size:]
+	}
+	tag := []rune(hashtag)
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", ErrInvalidHashtag
+		}
+	}
+	if !valid(tag) {
+		return "", ErrInvalidHashtag
+	}
+	return normalize(tag), nil
+}
+
+// normalize applies NFKC before lowercasing, so that "café" matches
+// whichever way the "é" was typed, and fullwidth "Ｇｏ" matches "go".
+func normalize(tag []rune) string {
+	return strings.ToLower(norm.NFKC.String(string(tag)))
+}
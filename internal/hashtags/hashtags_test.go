@@ -0,0 +1,106 @@
+package hashtags
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	cases := map[string][]Hashtag{
+		"":                      nil,
+		"no tags here":          nil,
+		"#go":                   {{Tag: "go", Start: 0, End: 3}},
+		"Learning #Go today":    {{Tag: "go", Start: 9, End: 12}},
+		"#go, #rust.":           {{Tag: "go", Start: 0, End: 3}, {Tag: "rust", Start: 5, End: 10}},
+		"#snake_case":           {{Tag: "snake_case", Start: 0, End: 11}},
+		"#2024 and #web3":       {{Tag: "web3", Start: 10, End: 15}},
+		"café #Café":            {{Tag: "café", Start: 5, End: 10}},
+		"東京 ＃東京タワー":             {{Tag: "東京タワー", Start: 3, End: 9}},
+		"#नमस्ते":               {{Tag: "नमस्ते", Start: 0, End: 7}},
+		"#Привет мир":           {{Tag: "привет", Start: 0, End: 7}},
+		"a#b":                   nil,
+		"it&#39;s":              nil,
+		"##go":                  nil,
+		"#a#b #ok":              {{Tag: "ok", Start: 5, End: 8}},
+		"#":                     nil,
+		"# go":                  nil,
+		"(#go)":                 {{Tag: "go", Start: 1, End: 4}},
+		"#" + long(MaxLength+1): nil,
+	}
+	for input, want := range cases {
+		got := Extract(input)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v", input, want, got)
+		}
+	}
+}
+
+func TestExtract_MaxLength(t *testing.T) {
+	tag := long(MaxLength)
+	got := Extract("#" + tag)
+	if len(got) != 1 || got[0].Tag != tag {
+		t.Errorf("Expected a hashtag of %d characters, got %v", MaxLength, got)
+	}
+}
+
+func TestExtract_UnicodeNormalization(t *testing.T) {
+	composed := Extract("#caf\u00e9")
+	decomposed := Extract("#cafe\u0301")
+	if len(composed) != 1 || len(decomposed) != 1 {
+		t.Fatalf("Expected one hashtag each, got %v and %v", composed, decomposed)
+	}
+	if composed[0].Tag != decomposed[0].Tag {
+		t.Errorf("Expected %q and %q to match", composed[0].Tag, decomposed[0].Tag)
+	}
+	// Offsets still count the characters as they were typed.
+	if decomposed[0].End != 6 {
+		t.Errorf("Expected the decomposed hashtag to end at 6, got %d", decomposed[0].End)
+	}
+
+	got := Tags(Extract("#caf\u00e9 #CAFE\u0301 #ｃａｆé"))
+	want := []string{"caf\u00e9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	got := Tags(Extract("#Go #rust #go #GO #zig"))
+	want := []string{"go", "rust", "zig"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"go":         "go",
+		"#Go":        "go",
+		"＃東京":        "東京",
+		"Привет":     "привет",
+		"#Ｇｏ":        "go",
+		"cafe\u0301": "caf\u00e9",
+	}
+	for input, want := range cases {
+		got, err := Normalize(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", input, want, got)
+		}
+	}
+
+	for _, input := range []string{"", "#", "123", "go lang", "go-lang", "##go", long(MaxLength + 1)} {
+		if _, err := Normalize(input); !errors.Is(err, ErrInvalidHashtag) {
+			t.Errorf("%q: expected %v, got %v", input, ErrInvalidHashtag, err)
+		}
+	}
+}
+
+func long(n int) string {
+	return strings.Repeat("a", n)
+}
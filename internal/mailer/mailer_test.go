@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New("file", dir)
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	err = m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "token: abc"})
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one message file, got %v (%v)", files, err)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	for _, want := range []string{"To: user@example.com", "Subject: Hello", "token: abc"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected message to contain %q, got %q", want, data)
+		}
+	}
+}
+
+func TestNew_UnknownMailer(t *testing.T) {
+	if _, err := New("carrier-pigeon", ""); err == nil {
+		t.Error("Expected error for unknown mailer, got nil")
+	}
+}
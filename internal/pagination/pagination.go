@@ -0,0 +1,56 @@
+// Package pagination implements keyset pagination helpers: opaque cursors
+// and page size limits.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+const (
+	// DefaultLimit is the page size when the client doesn't ask for one.
+	DefaultLimit = 50
+	// MaxLimit is the largest page size served, whatever the client asks
+	// for.
+	MaxLimit = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns v, usually the sort key of the last item on a page,
+// into an opaque string that is safe to put in a URL.
+func EncodeCursor(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor reads a cursor made by EncodeCursor into v. Anything that
+// wasn't made by EncodeCursor yields ErrInvalidCursor.
+func DecodeCursor(cursor string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// ParseLimit reads a requested page size. An empty value gives
+// DefaultLimit and values above MaxLimit are capped.
+func ParseLimit(s string) (int, error) {
+	if s == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive number")
+	}
+	return min(limit, MaxLimit), nil
+}
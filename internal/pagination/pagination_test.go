@@ -0,0 +1,69 @@
+package pagination
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := testCursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), ID: uuid.New()}
+
+	cursor, err := EncodeCursor(want)
+	if err != nil {
+		t.Fatalf("Failed to encode cursor: %v", err)
+	}
+	if strings.ContainsAny(cursor, "+/=") {
+		t.Errorf("Expected a URL-safe cursor, got %q", cursor)
+	}
+
+	var got testCursor
+	if err := DecodeCursor(cursor, &got); err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "eyJpZCI6IDEyM30"} {
+		var got testCursor
+		if err := DecodeCursor(cursor, &got); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]int{
+		"":    DefaultLimit,
+		"1":   1,
+		"25":  25,
+		"100": MaxLimit,
+		"500": MaxLimit,
+	}
+	for input, want := range cases {
+		got, err := ParseLimit(input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("%q: expected %d, got %d", input, want, got)
+		}
+	}
+
+	for _, input := range []string{"0", "-5", "ten"} {
+		if _, err := ParseLimit(input); err == nil {
+			t.Errorf("%q: expected error, got nil", input)
+		}
+	}
+}
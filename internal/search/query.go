@@ -0,0 +1,181 @@
+// Package search turns user-typed search queries into PostgreSQL full-text
+// search queries.
+package search
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxQueryLength is the longest query accepted, in characters.
+	MaxQueryLength = 256
+	// maxTerms bounds the size of the generated tsquery.
+	maxTerms = 32
+)
+
+var (
+	ErrEmptyQuery    = errors.New("search query has no words to match")
+	ErrQueryTooLong  = errors.New("search query is too long")
+	ErrTooManyTerms  = errors.New("search query has too many terms")
+	ErrOnlyNegations = errors.New("search query needs at least one word that isn't excluded")
+)
+
+// term is one word or phrase of a query.
+type term struct {
+	words   []string
+	prefix  bool
+	negated bool
+}
+
+// tsquery renders the term in to_tsquery syntax. The words only contain
+// letters and digits, so they need no quoting.
+func (t term) tsquery() string {
+	s := strings.Join(t.words, " <-> ")
+	if t.prefix {
+		s += ":*"
+	}
+	if len(t.words) > 1 {
+		s = "(" + s + ")"
+	}
+	if t.negated {
+		s = "!" + s
+	}
+	return s
+}
+
+// ToTSQuery converts a query in a small web search syntax to the input of
+// PostgreSQL's to_tsquery:
+//
+//   - words must all match: cat hat becomes cat & hat
+//   - "quoted words" must match as a phrase: "cat hat" becomes (cat <-> hat)
+//   - a trailing * matches prefixes: chirp* becomes chirp:*
+//   - a leading - excludes a word or phrase: -dog becomes !dog
+//   - OR between two terms matches either: cat OR dog becomes (cat | dog)
+//
+// Punctuation inside a word splits it into a phrase, as the text search
+// parser does for the indexed text. Anything that isn't a letter or digit
+// is dropped, so the result is always valid tsquery syntax.
+func ToTSQuery(query string) (string, error) {
+	if utf8.RuneCountInString(query) > MaxQueryLength {
+		return "", ErrQueryTooLong
+	}
+
+	// groups are ANDed together; the terms of a group are ORed.
+	var groups [][]term
+	joinNext := false
+	count := 0
+	positive := false
+
+	for _, token := range tokenize(query) {
+		if token == "OR" {
+			joinNext = len(groups) > 0
+			continue
+		}
+
+		t, ok := parseTerm(token)
+		if !ok {
+			continue
+		}
+		count++
+		if count > maxTerms {
+			return "", ErrTooManyTerms
+		}
+
+		if joinNext {
+			last := len(groups) - 1
+			groups[last] = append(groups[last], t)
+		} else {
+			groups = append(groups, []term{t})
+		}
+		joinNext = false
+	}
+
+	if len(groups) == 0 {
+		return "", ErrEmptyQuery
+	}
+
+	parts := make([]string, 0, len(groups))
+	for _, group := range groups {
+		alternatives := make([]string, 0, len(group))
+		groupPositive := true
+		for _, t := range group {
+			alternatives = append(alternatives, t.tsquery())
+			groupPositive = groupPositive && !t.negated
+		}
+		positive = positive || groupPositive
+
+		if len(alternatives) == 1 {
+			parts = append(parts, alternatives[0])
+		} else {
+			parts = append(parts, "("+strings.Join(alternatives, " | ")+")")
+		}
+	}
+
+	// A query that only excludes would match nearly every chirp and can't
+	// use the index.
+	if !positive {
+		return "", ErrOnlyNegations
+	}
+
+	return strings.Join(parts, " & "), nil
+}
+
+// tokenize splits a query on whitespace, keeping quoted phrases together
+// along with a leading - and trailing *.
+func tokenize(query string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parseTerm reads one token. It reports false if the token has no letters
+// or digits to search for.
+func parseTerm(token string) (term, bool) {
+	var t term
+	if strings.HasPrefix(token, "-") {
+		t.negated = true
+		token = token[1:]
+	}
+	if strings.HasSuffix(token, "*") && !strings.HasSuffix(token, `"*`) {
+		t.prefix = true
+		token = strings.TrimRight(token, "*")
+	}
+
+	t.words = strings.FieldsFunc(strings.ToLower(token), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return t, len(t.words) > 0
+}
+
+// SafeHeadline escapes a ts_headline snippet for use as HTML, keeping only
+// the <mark> and </mark> tags that highlight matches.
+func SafeHeadline(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, "&lt;mark&gt;", "<mark>")
+	return strings.ReplaceAll(escaped, "&lt;/mark&gt;", "</mark>")
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestToTSQuery(t *testing.T) {
+	cases := map[string]string{
+		"cat":                   "cat",
+		"Cat  hat":              "cat & hat",
+		`"cat in the hat"`:      "(cat <-> in <-> the <-> hat)",
+		"chirp*":                "chirp:*",
+		"-dog cat":              "!dog & cat",
+		`cat -"hot dog"`:        "cat & !(hot <-> dog)",
+		"cat OR dog":            "(cat | dog)",
+		"big cat OR dog bird":   "big & (cat | dog) & bird",
+		"cat OR dog OR bird":    "(cat | dog | bird)",
+		"OR cat":                "cat",
+		"e-mail*":               "(e <-> mail:*)",
+		"it's":                  "(it <-> s)",
+		"café über":             "café & über",
+		"cat & dog | !(x) :* '": "cat & dog & x",
+	}
+	for input, want := range cases {
+		got, err := ToTSQuery(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", input, want, got)
+		}
+	}
+}
+
+func TestToTSQuery_Errors(t *testing.T) {
+	cases := map[string]error{
+		"":                                    ErrEmptyQuery,
+		"   ":                                 ErrEmptyQuery,
+		"!!! ***":                             ErrEmptyQuery,
+		"-cat":                                ErrOnlyNegations,
+		"-cat OR -dog":                        ErrOnlyNegations,
+		strings.Repeat("a", MaxQueryLength+1): ErrQueryTooLong,
+		strings.Repeat("a ", maxTerms+1):      ErrTooManyTerms,
+	}
+	for input, want := range cases {
+		if _, err := ToTSQuery(input); !errors.Is(err, want) {
+			t.Errorf("%q: expected %v, got %v", input, want, err)
+		}
+	}
+}
+
+func TestSafeHeadline(t *testing.T) {
+	got := SafeHeadline(`<script>alert("x")</script> a <mark>cat</mark> & more`)
+	want := `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; a <mark>cat</mark> &amp; more`
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+// Introspection is a token introspection response (RFC 7662). Inactive
+// tokens only get Active, so nothing is revealed about them.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	// Actor is the admin behind an impersonation token.
+	Actor     *auth.Actor `json:"act,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	// Role and ChirpyRed are the user's current values, which may be newer
+	// than the claims in an access token.
+	Role      string `json:"role,omitempty"`
+	ChirpyRed bool   `json:"chirpy_red,omitempty"`
+}
+
+// introspectHandler lets internal services check whether a token is still
+// valid. Callers authenticate with "ApiKey <INTROSPECTION_KEY>"; the endpoint
+// is disabled while no key is configured.
+func (cfg *apiConfig) introspectHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil || cfg.introspectionKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.introspectionKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	var result Introspection
+	switch {
+	case auth.IsPersonalAccessToken(token):
+		result = cfg.introspectPersonalAccessToken(r.Context(), token)
+	case strings.Count(token, ".") == 2:
+		result = cfg.introspectAccessToken(r.Context(), token)
+	default:
+		result = cfg.introspectRefreshToken(r.Context(), token)
+	}
+
+	if result.Active {
+		user, err := cfg.db.GetUserByID(r.Context(), uuid.MustParse(result.Subject))
+		if err != nil {
+			result = Introspection{}
+		} else {
+			result.Username = user.Email
+			result.Role = user.Role
+			result.ChirpyRed = user.IsChirpyRed
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// introspectAccessToken checks the signature and claims of an access token
+// and whether the session it was issued with has been revoked since.
+func (cfg *apiConfig) introspectAccessToken(ctx context.Context, token string) Introspection {
+	claims, err := cfg.parseAccessToken(ctx, token)
+	if err != nil {
+		return Introspection{}
+	}
+
+	if claims.SessionID != "" {
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return Introspection{}
+		}
+		active, err := cfg.db.IsSessionActive(ctx, sessionID)
+		if err != nil || !active {
+			return Introspection{}
+		}
+	}
+
+	return Introspection{
+		Active:    true,
+		TokenType: "access_token",
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.ID,
+		SessionID: claims.SessionID,
+		Actor:     claims.Actor,
+		IssuedAt:  claims.IssuedAt.Unix(),
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}
+}
+
+func (cfg *apiConfig) introspectPersonalAccessToken(ctx context.Context, token string) Introspection {
+	pat, err := cfg.db.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token))
+	if err != nil || pat.RevokedAt.Valid || pat.ExpiresAt.Valid && !pat.ExpiresAt.Time.After(time.Now().UTC()) {
+		return Introspection{}
+	}
+
+	result := Introspection{
+		Active:    true,
+		TokenType: "personal_access_token",
+		Scope:     strings.Join(pat.Scopes, " "),
+		Subject:   pat.UserID.String(),
+		ID:        pat.ID.String(),
+		IssuedAt:  pat.CreatedAt.Unix(),
+	}
+	if pat.ExpiresAt.Valid {
+		result.ExpiresAt = pat.ExpiresAt.Time.Unix()
+	}
+	return result
+}
+
+func (cfg *apiConfig) introspectRefreshToken(ctx context.Context, token string) Introspection {
+	stored, err := cfg.db.GetUserToken(ctx, token)
+	if err != nil || stored.RevokedAt.Valid || !stored.ExpiresAt.After(time.Now().UTC()) {
+		return Introspection{}
+	}
+
+	return Introspection{
+		Active:    true,
+		TokenType: "refresh_token",
+		Scope:     refreshTokenScope(stored),
+		ClientID:  nullUUIDString(stored.ClientID),
+		Subject:   stored.UserID.String(),
+		SessionID: stored.FamilyID.String(),
+		IssuedAt:  stored.CreatedAt.Unix(),
+		ExpiresAt: stored.ExpiresAt.Unix(),
+	}
+}
+
+// refreshTokenScope is the scope of the access tokens a refresh token
+// yields: everything for a login session, the granted scopes for a client.
+func refreshTokenScope(stored database.Refreshtoken) string {
+	if !stored.ClientID.Valid {
+		return strings.Join(auth.AllScopes(), " ")
+	}
+	return strings.Join(stored.Scopes, " ")
+}
+
+func nullUUIDString(id uuid.NullUUID) string {
+	if !id.Valid {
+		return ""
+	}
+	return id.UUID.String()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/pagination"
+)
+
+// ChirpLike is a user who liked a chirp.
+type ChirpLike struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// likeCursor is the sort key of the last like on a page.
+type likeCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+// viewerFromRequest returns who is reading chirps on an endpoint that
+// doesn't require signing in: uuid.Nil without an Authorization header or
+// with a token lacking the chirps:read scope. A token that is present but
+// invalid is still an error; it responds with it and returns false.
+func (cfg *apiConfig) viewerFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, true
+	}
+	p, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return uuid.Nil, false
+	}
+	if !p.can(auth.ScopeChirpsRead) {
+		return uuid.Nil, true
+	}
+	return p.UserID, true
+}
+
+// likeChirpHandler likes a chirp for the caller. Liking it again changes
+// nothing.
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	// Liking a rechirp likes the chirp it reposts.
+	chirp, err := cfg.repostTarget(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp")
+		return
+	}
+
+	_, err = cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: chirp.ID,
+		UserID:  caller.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unlikeChirpHandler takes back the caller's like of a chirp. Chirps that
+// aren't liked are left alone.
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	// A deleted chirp can still be unliked by its ID; only a rechirp needs
+	// resolving to the chirp that was liked.
+	chirp, err := cfg.repostTarget(r.Context(), chirpID)
+	switch {
+	case err == nil:
+		chirpID = chirp.ID
+	case !errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp")
+		return
+	}
+
+	_, err = cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirpID,
+		UserID:  caller.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// chirpLikesHandler lists who liked a chirp, most recent first.
+func (cfg *apiConfig) chirpLikesHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	// The likes of a rechirp are those of the chirp it reposts, which is
+	// also what its like count shows.
+	chirp, err := cfg.repostTarget(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list likes")
+		return
+	}
+
+	limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpLikesParams{ChirpID: chirp.ID}
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		var cursor likeCursor
+		if err := pagination.DecodeCursor(cursorParam, &cursor); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.BeforeUserID = uuid.NullUUID{UUID: cursor.UserID, Valid: true}
+	}
+
+	likes, err := fetchPage(cfg, w, r, limit, func(limit int32) ([]database.ChirpLike, error) {
+		params.Limit = limit
+		return cfg.db.ListChirpLikes(r.Context(), params)
+	}, func(last database.ChirpLike) any {
+		return likeCursor{CreatedAt: last.CreatedAt, UserID: last.UserID}
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list likes")
+		return
+	}
+
+	result := make([]ChirpLike, 0, len(likes))
+	for _, like := range likes {
+		result = append(result, ChirpLike{UserID: like.UserID, LikedAt: like.CreatedAt})
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+// Failed logins are counted per account and per client address. The address
+// limit is higher because many users can share one address behind a NAT.
+var (
+	accountLockoutPolicy = auth.LockoutPolicy{
+		Threshold: 5,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  15 * time.Minute,
+		Window:    time.Hour,
+	}
+	ipLockoutPolicy = auth.LockoutPolicy{
+		Threshold: 20,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  15 * time.Minute,
+		Window:    time.Hour,
+	}
+)
+
+// loginFailurePurgeInterval is how often failures that no policy counts
+// anymore are removed.
+const loginFailurePurgeInterval = time.Hour
+
+const invalidCredentialsMessage = "Incorrect email or password"
+
+type loginThrottle struct {
+	key    string
+	policy auth.LockoutPolicy
+}
+
+func accountThrottle(email string) loginThrottle {
+	return loginThrottle{key: "email:" + strings.ToLower(strings.TrimSpace(email)), policy: accountLockoutPolicy}
+}
+
+func ipThrottle(r *http.Request) loginThrottle {
+	return loginThrottle{key: "ip:" + clientIP(r), policy: ipLockoutPolicy}
+}
+
+// lockedFor returns how much longer the most restrictive of the throttles
+// stays locked, or zero if none is.
+func (cfg *apiConfig) lockedFor(ctx context.Context, throttles ...loginThrottle) time.Duration {
+	var lockedFor time.Duration
+	for _, t := range throttles {
+		failure, err := cfg.db.GetLoginFailure(ctx, t.key)
+		if err != nil || !failure.LockedUntil.Valid {
+			continue
+		}
+		lockedFor = max(lockedFor, time.Until(failure.LockedUntil.Time))
+	}
+	return lockedFor
+}
+
+// checkLoginLockout responds with 429 and returns false if any of the
+// throttles is currently locked.
+func (cfg *apiConfig) checkLoginLockout(w http.ResponseWriter, r *http.Request, throttles ...loginThrottle) bool {
+	lockedFor := cfg.lockedFor(r.Context(), throttles...)
+	if lockedFor <= 0 {
+		return true
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(lockedFor.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+	return false
+}
+
+// recordLoginFailure counts a failed attempt against every throttle and locks
+// the ones that crossed their policy's threshold.
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, throttles ...loginThrottle) {
+	for _, t := range throttles {
+		failures, err := cfg.db.RecordLoginFailure(r.Context(), database.RecordLoginFailureParams{
+			Key:          t.key,
+			LastFailedAt: time.Now().Add(-t.policy.Window),
+		})
+		if err != nil {
+			log.Printf("couldn't record login failure: %s", err)
+			continue
+		}
+
+		delay := t.policy.Delay(int(failures))
+		if delay == 0 {
+			continue
+		}
+
+		err = cfg.db.LockLogin(r.Context(), database.LockLoginParams{
+			Key:         t.key,
+			LockedUntil: sql.NullTime{Time: time.Now().Add(delay), Valid: true},
+		})
+		if err != nil {
+			log.Printf("couldn't lock login: %s", err)
+		}
+	}
+}
+
+// clearLoginFailures resets the account throttle after a successful login.
+// The address throttle is left alone so an attacker can't reset it by
+// logging into an account of their own.
+func (cfg *apiConfig) clearLoginFailures(r *http.Request, email string) {
+	if err := cfg.db.ClearLoginFailures(r.Context(), accountThrottle(email).key); err != nil {
+		log.Printf("couldn't clear login failures: %s", err)
+	}
+}
+
+// purgeLoginFailures removes the failures of keys that have had none for
+// longer than any policy's window and aren't locked.
+func (cfg *apiConfig) purgeLoginFailures(ctx context.Context) {
+	window := max(accountLockoutPolicy.Window, ipLockoutPolicy.Window,
+		resetEmailLockoutPolicy.Window, resetIPLockoutPolicy.Window)
+	purged, err := cfg.db.PurgeLoginFailures(ctx, time.Now().Add(-window))
+	if err != nil {
+		log.Printf("couldn't purge login failures: %s", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d old login failures", purged)
+	}
+}
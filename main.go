@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -15,6 +18,10 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/sabrek15/chirpy/internal/auth"
 	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/mailer"
+	"github.com/sabrek15/chirpy/internal/pagination"
+
+	"golang.org/x/crypto/bcrypt"
 
 	_ "github.com/lib/pq"
 )
@@ -22,9 +29,19 @@ import (
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db 	*database.Queries
+	conn	*sql.DB
 	platform string
-	tokenSecret	string
+	keys	*auth.KeySet
 	polkaKey string
+	mailer	mailer.Mailer
+	passwords	*auth.Passwords
+	passwordPolicy	auth.PasswordPolicy
+	baseURL	string
+	requireVerifiedEmail bool
+	bootstrapAdminEmail string
+	introspectionKey string
+	chirpRestoreWindow time.Duration
+	chirpRetention time.Duration
 }
 
 
@@ -32,6 +49,11 @@ type errorResponse struct {
 	Error string `json:"error"`
 }
 
+type passwordPolicyResponse struct {
+	Error string `json:"error"`
+	Violations []auth.PolicyViolation `json:"violations"`
+}
+
 // type messageResponse struct {
 // 	Message string `json:"message"`
 // }
@@ -47,8 +69,15 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Email     string    `json:"email"`
+	IsChirpyRed bool `json:"is_chirpy_red"`
+	EmailVerified bool `json:"email_verified"`
+	Role string `json:"role"`
 }
 
+// refreshTokenExpiration is how long a refresh token stays valid. Every
+// rotation issues a fresh token with a new window.
+const refreshTokenExpiration = time.Hour * 24 * 60
+
 const metric string = `<html>
   <body>
     <h1>Welcome, Chirpy Admin</h1>
@@ -94,6 +123,11 @@ func (cfg *apiConfig) userResetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.keys.JWKS())
+}
+
 func readinessHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -129,6 +163,15 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 // 	w.Write(responseBody)
 // }
 
+// respondWithPasswordViolations tells the client every password rule that
+// failed, so it can show them all at once.
+func respondWithPasswordViolations(w http.ResponseWriter, violations []auth.PolicyViolation) {
+	respondWithJSON(w, http.StatusBadRequest, passwordPolicyResponse{
+		Error: "Password does not meet the password policy",
+		Violations: violations,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.WriteHeader(code)
 	responseBody, _ := json.Marshal(payload)
@@ -151,7 +194,17 @@ func (cfg *apiConfig) PostUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPasword(req.Password)
+	if !validEmail(req.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+
+	if violations := cfg.passwordPolicy.Validate(req.Password, req.Email); violations != nil {
+		respondWithPasswordViolations(w, violations)
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(req.Password)
 	if err != nil {
 		respondWithError(w, http.StatusConflict, "Couldn't hash password")
 		return
@@ -166,7 +219,19 @@ func (cfg *apiConfig) PostUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, user)
+	if err := cfg.sendEmailVerification(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("couldn't send verification email: %s", err)
+	}
+
+	respondWithJSON(w, http.StatusCreated, User{
+		ID: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
+	})
 }
 
 func (cfg *apiConfig) updateUsers(w http.ResponseWriter, r *http.Request) {
@@ -194,13 +259,44 @@ func (cfg *apiConfig) updateUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user_id, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	claims, err := cfg.validateSession(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	user_id := uuid.MustParse(claims.Subject)
 
-	hashedPassword, err := auth.HashPasword(req.Password)
+	currentUser, err := cfg.db.GetUserByID(r.Context(), user_id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	// A new address only replaces the current one once it has been
+	// confirmed through the link sent to it.
+	pendingEmail := ""
+	if req.Email != "" && req.Email != currentUser.Email {
+		if !validEmail(req.Email) {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		if _, err := cfg.db.GetUserByEmail(r.Context(), req.Email); err == nil {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+		pendingEmail = req.Email
+	}
+
+	if violations := cfg.passwordPolicy.Validate(req.Password, currentUser.Email, pendingEmail); violations != nil {
+		respondWithPasswordViolations(w, violations)
+		return
+	}
+
+	// Keeping the same password leaves the other sessions alone.
+	_, err = cfg.passwords.Verify(currentUser.HashedPassword, req.Password)
+	passwordChanged := err != nil
+
+	hashedPassword, err := cfg.passwords.Hash(req.Password)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
@@ -211,10 +307,20 @@ func (cfg *apiConfig) updateUsers(w http.ResponseWriter, r *http.Request) {
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time	`json:"updated_at"`
 		Email string `json:"email"`
+		EmailVerified bool `json:"email_verified"`
+		PendingEmail string `json:"pending_email,omitempty"`
+	}
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update the user")
+		return
 	}
-	user, err := cfg.db.UpdateUserCredentials(r.Context(), database.UpdateUserCredentialsParams{
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.UpdateUserCredentials(r.Context(), database.UpdateUserCredentialsParams{
 		ID: user_id,
-		Email: req.Email,
+		Email: currentUser.Email,
 		HashedPassword: hashedPassword,
 	})
 	if err != nil {
@@ -222,11 +328,72 @@ func (cfg *apiConfig) updateUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userDetails := param{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email}
+	// Every other session, and the access tokens issued to it, belonged to
+	// the old password. The session making the change stays logged in.
+	if passwordChanged {
+		sessionID, _ := uuid.Parse(claims.SessionID)
+		err = qtx.RevokeOtherUserAccessTokens(r.Context(), database.RevokeOtherUserAccessTokensParams{
+			UserID: user_id,
+			FamilyID: sessionID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke other sessions")
+			return
+		}
+
+		err = qtx.RevokeOtherUserTokens(r.Context(), database.RevokeOtherUserTokensParams{
+			UserID: user_id,
+			FamilyID: sessionID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke other sessions")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update the user")
+		return
+	}
+
+	if pendingEmail != "" {
+		if err := cfg.sendEmailVerification(r.Context(), user.ID, pendingEmail); err != nil {
+			log.Printf("couldn't send verification email: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+			return
+		}
+	}
+
+	userDetails := param{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, EmailVerified: currentUser.EmailVerifiedAt.Valid, PendingEmail: pendingEmail}
 
 	respondWithJSON(w, http.StatusOK, userDetails)
 }
 
+// currentUserHandler returns the caller's own account. OAuth clients use it
+// to learn who signed in.
+func (cfg *apiConfig) currentUserHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeUsersRead)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
+	})
+}
+
 func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -246,22 +413,80 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	throttles := []loginThrottle{accountThrottle(req.Email), ipThrottle(r)}
+	if !cfg.checkLoginLockout(w, r, throttles...) {
+		return
+	}
+
+	// Unknown accounts and wrong passwords get the same response and take
+	// the same time, so the endpoint can't be used to find registered emails.
 	user, err := cfg.db.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		cfg.passwords.VerifyDummy(req.Password)
+		cfg.recordLoginFailure(r, throttles...)
+		respondWithError(w, http.StatusUnauthorized, invalidCredentialsMessage)
 		return
 	}
 
-	
-	if err := auth.CheckPassword(user.HashedPassword, req.Password); err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Wrong Password")
+	needsRehash, err := cfg.passwords.Verify(user.HashedPassword, req.Password)
+	if err != nil {
+		cfg.recordLoginFailure(r, throttles...)
+		respondWithError(w, http.StatusUnauthorized, invalidCredentialsMessage)
 		return 
 	}
 
+	if needsRehash {
+		cfg.rehashPassword(r, user.ID, req.Password)
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	cfg.clearLoginFailures(r, user.Email)
+	cfg.issueSession(w, r, user)
+}
+
+// rehashPassword replaces a stored hash made with an older algorithm or
+// weaker parameters. It runs on login, the only time the plain password is
+// available; failures just leave the old hash in place.
+func (cfg *apiConfig) rehashPassword(r *http.Request, userID uuid.UUID, password string) {
+	hashedPassword, err := cfg.passwords.Hash(password)
+	if err != nil {
+		log.Printf("couldn't rehash password: %s", err)
+		return
+	}
+
+	err = cfg.db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID: userID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		log.Printf("couldn't store rehashed password: %s", err)
+	}
+}
+
+// accessTokenFor describes an access token for user in the session
+// identified by the refresh token family sessionID.
+func accessTokenFor(user database.User, sessionID uuid.UUID) auth.AccessToken {
+	return auth.AccessToken{
+		UserID: user.ID,
+		Role: auth.Role(user.Role),
+		ChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		SessionID: sessionID,
+	}
+}
+
+// issueSession starts a new session for a fully authenticated user and
+// responds with the user's details and tokens.
+func (cfg *apiConfig) issueSession(w http.ResponseWriter, r *http.Request, user database.User) {
 	const maxExpiration = time.Hour
 	expiration := maxExpiration
+	sessionID := uuid.New()
 
-	jwtToken, err := auth.MakeJWT(user.ID, cfg.tokenSecret, expiration)
+	accessToken, err := cfg.signAccessToken(accessTokenFor(user, sessionID), expiration)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Couldn't generate JWTToken")
 		return 
@@ -273,12 +498,16 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	const expire = time.Hour * 24 * 60
-	expireToken := time.Now().Add(expire)
+	expireToken := time.Now().Add(refreshTokenExpiration)
 	_, err = cfg.db.CreateToken(r.Context(), database.CreateTokenParams{
 		Token: refreshToken,
 		UserID: user.ID,
 		ExpiresAt: expireToken,
+		FamilyID: sessionID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		AccessTokenID: accessToken.nullID(),
+		AccessTokenExpiresAt: accessToken.nullExpiresAt(),
 	})
 
 	if err != nil {
@@ -292,11 +521,12 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt time.Time `json:"updated_at"`
 		Email     string    `json:"email"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
+		Role	string	`json:"role"`
 		Token	  string	`json:"token"`
 		RefreshToken string `json:"refresh_token"`
 	}
 
-	param := userWithJWT{Id: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, IsChirpyRed: user.IsChirpyRed, Token: jwtToken, RefreshToken: refreshToken}
+	param := userWithJWT{Id: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, IsChirpyRed: user.IsChirpyRed, Role: user.Role, Token: accessToken.Token, RefreshToken: refreshToken}
 	
 	respondWithJSON(w, http.StatusOK, param)
 }
@@ -309,33 +539,132 @@ func (cfg *apiConfig) refreshUserToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	storedRefreshToken, err := cfg.db.GetUserToken(r.Context(), tokenstring)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+	// Tokens issued to OAuth clients are refreshed at /oauth/token, where
+	// the client authenticates and the scopes are kept.
+	if err != nil || storedRefreshToken.ClientID.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
 		return 
 	}
 
-	if storedRefreshToken.RevokedAt.Valid {
-		respondWithError(w, http.StatusUnauthorized, "Refresh Token is revoked")
-		return 
-	}
-
-	if time.Now().UTC().After(storedRefreshToken.ExpiresAt) {
-		respondWithError(w, http.StatusUnauthorized, "Refresh token is expired")
-		return 
+	// The user is read again so that changes to the role, membership or
+	// email verification reach the next access token.
+	user, err := cfg.db.GetUserByID(r.Context(), storedRefreshToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find the user")
+		return
 	}
 
-
-	newAccessToken, err := auth.MakeJWT(storedRefreshToken.UserID, cfg.tokenSecret, time.Hour)
+	newAccessToken, err := cfg.signAccessToken(accessTokenFor(user, storedRefreshToken.FamilyID), time.Hour)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	newRefreshToken, err := cfg.rotateRefreshToken(r, storedRefreshToken, newAccessToken)
+	switch {
+	case errors.Is(err, errRefreshTokenReused):
+		respondWithError(w, http.StatusUnauthorized, "Refresh token reuse detected, please log in again")
+		return
+	case errors.Is(err, errRefreshTokenRevoked):
+		respondWithError(w, http.StatusUnauthorized, "Refresh Token is revoked")
+		return
+	case errors.Is(err, errRefreshTokenExpired):
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is expired")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token")
+		return
+	}
+
 	type refreshResponse struct {
 		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	respondWithJSON(w, http.StatusOK, refreshResponse{Token: newAccessToken.Token, RefreshToken: newRefreshToken})
+}
+
+var (
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+	errRefreshTokenRevoked = errors.New("refresh token is revoked")
+	errRefreshTokenExpired = errors.New("refresh token is expired")
+)
+
+// rotateRefreshToken replaces stored with a new refresh token of the same
+// session, issued together with accessToken, and returns the new token.
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, stored database.Refreshtoken, accessToken signedAccessToken) (string, error) {
+	if stored.RevokedAt.Valid {
+		// A token that was already rotated is being replayed: either the
+		// client or an attacker holds a stale copy, so the whole family is
+		// treated as compromised.
+		if stored.ReplacedBy.Valid {
+			return "", cfg.revokeTokenFamily(r, stored.FamilyID)
+		}
+		return "", errRefreshTokenRevoked
+	}
+
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		return "", errRefreshTokenExpired
 	}
 
-	respondWithJSON(w, http.StatusOK, refreshResponse{Token: newAccessToken})
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	rotated, err := qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token: stored.Token,
+		ReplacedBy: sql.NullString{String: newRefreshToken, Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	if rotated == 0 {
+		// Another request rotated this token between our read and the
+		// update, which is the same as a replay.
+		tx.Rollback()
+		return "", cfg.revokeTokenFamily(r, stored.FamilyID)
+	}
+
+	_, err = qtx.CreateToken(r.Context(), database.CreateTokenParams{
+		Token: newRefreshToken,
+		UserID: stored.UserID,
+		ExpiresAt: time.Now().Add(refreshTokenExpiration),
+		FamilyID: stored.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ClientID: stored.ClientID,
+		Scopes: stored.Scopes,
+		AccessTokenID: accessToken.nullID(),
+		AccessTokenExpiresAt: accessToken.nullExpiresAt(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return newRefreshToken, nil
+}
+
+// revokeTokenFamily revokes every refresh token descended from the same login
+// after a rotated token was replayed, forcing the user to log in again. It
+// returns errRefreshTokenReused once the family is revoked.
+func (cfg *apiConfig) revokeTokenFamily(r *http.Request, familyID uuid.UUID) error {
+	err := cfg.endSession(r.Context(), familyID)
+	if err != nil {
+		return fmt.Errorf("couldn't revoke refresh token family: %w", err)
+	}
+	log.Printf("refresh token reuse detected, revoked family %s", familyID)
+	return errRefreshTokenReused
 }
 
 func (cfg *apiConfig) refreshTokenRevoke(w http.ResponseWriter, r *http.Request) {
@@ -345,7 +674,15 @@ func (cfg *apiConfig) refreshTokenRevoke(w http.ResponseWriter, r *http.Request)
 		return 
 	}
 
-	err = cfg.db.RevokeRefreshToken(r.Context(), token)
+	storedRefreshToken, err := cfg.db.GetUserToken(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	// Revoking a token logs out the whole session, including any token it
+	// was rotated into and the access tokens issued with them.
+	err = cfg.endSession(r.Context(), storedRefreshToken.FamilyID)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return 
@@ -360,42 +697,100 @@ func (cfg *apiConfig) postChirpsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return 
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return 
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
 	}
+	userID := caller.UserID
 	
 	defer r.Body.Close()
 	type parameters struct {
 		Body	string `json:"body"`
+		ReplyToID *uuid.UUID `json:"reply_to_id"`
+		QuotedChirpID *uuid.UUID `json:"quoted_chirp_id"`
 	}
 	var req parameters
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if len(req.Body) > 140 {
+	if !cfg.checkCanPost(w, r, caller) {
+		return
+	}
+
+	cleanedBody, ok := cleanChirpBody(req.Body)
+	if !ok {
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
 		return
 	}
-	
-	cleanedBody := cleanChirp(req.Body)
 
-	chirp, err := cfg.db.CreateChrips(r.Context(), database.CreateChripsParams{Body: cleanedBody, UserID: userID})
+	var replyToID uuid.NullUUID
+	if req.ReplyToID != nil {
+		// Replying to a rechirp replies to the chirp it reposts.
+		parent, err := cfg.repostTarget(r.Context(), *req.ReplyToID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Couldn't find the chirp to reply to")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't find the chirp to reply to")
+			return
+		}
+		replyToID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	kind := chirpKindChirp
+	var quotedChirpID uuid.NullUUID
+	if req.QuotedChirpID != nil {
+		if cleanedBody == "" {
+			respondWithError(w, http.StatusBadRequest, "A quote needs a body")
+			return
+		}
+		original, err := cfg.repostTarget(r.Context(), *req.QuotedChirpID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Couldn't find the chirp to quote")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't find the chirp to quote")
+			return
+		}
+		kind = chirpKindQuote
+		quotedChirpID = uuid.NullUUID{UUID: original.ID, Valid: true}
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.CreateChrips(r.Context(), database.CreateChripsParams{
+		Body: cleanedBody,
+		UserID: userID,
+		ReplyToID: replyToID,
+		Kind: kind,
+		QuotedChirpID: quotedChirpID,
+	})
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "couldn't create chirp")
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, chirp)
+
+	if err := indexHashtags(r.Context(), qtx, chirp.ID, chirp.Body); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create chirp")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create chirp")
+		return
+	}
+	cfg.respondWithChirp(w, r, userID, http.StatusCreated, chirp)
 }
 
 func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request){
@@ -404,29 +799,75 @@ func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request){
 		return
 	}
 	
-	defer r.Body.Close()
-	authorIDParam := r.URL.Query().Get("author_id")
-	if authorIDParam == "" {
-		chirps, err := cfg.db.GetChirps(r.Context())
-		if err != nil {
-			log.Fatal(err)
-		}
-		respondWithJSON(w, http.StatusFound, chirps)
+	viewer, ok := cfg.viewerFromRequest(w, r)
+	if !ok {
 		return
-	} else {
+	}
+
+	defer r.Body.Close()
+	params := database.ListChirpsParams{}
+	if authorIDParam := r.URL.Query().Get("author_id"); authorIDParam != "" {
 		authorID, err := uuid.Parse(authorIDParam)
 		if err != nil {
 			respondWithError(w, http.StatusNotFound, err.Error())
 			return
 		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
 
-		chirps, err := cfg.db.GetChirpsByAuthorID(r.Context(), authorID)
-		if err != nil {
-			respondWithError(w, http.StatusNotFound, err.Error())
+	limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	descending := false
+	switch r.URL.Query().Get("sort") {
+	case "", "asc":
+	case "desc":
+		descending = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "sort must be asc or desc")
+		return
+	}
+
+	params.Since, err = parseTimeParam(r, "since")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.Until, err = parseTimeParam(r, "until")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Since.Valid && params.Until.Valid && !params.Until.Time.After(params.Since.Time) {
+		respondWithError(w, http.StatusBadRequest, "until must be after since")
+		return
+	}
+
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		var cursor chirpCursor
+		if err := pagination.DecodeCursor(cursorParam, &cursor); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		respondWithJSON(w, http.StatusFound, chirps)
+		params.AfterCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
 	}
+
+	chirps, err := fetchPage(cfg, w, r, limit, func(limit int32) ([]database.Chirp, error) {
+		params.Limit = limit
+		if descending {
+			return cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(params))
+		}
+		return cfg.db.ListChirps(r.Context(), params)
+	}, chirpCursorAfter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list chirps")
+		return
+	}
+	cfg.respondWithChirps(w, r, viewer, http.StatusFound, chirps)
 }
 
 func (cfg *apiConfig) getChirpByID(w http.ResponseWriter, r *http.Request){
@@ -435,6 +876,11 @@ func (cfg *apiConfig) getChirpByID(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
+	viewer, ok := cfg.viewerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
 	chirpIDstr := r.PathValue("chirpid")
 	chirpID, err := uuid.Parse(chirpIDstr)
 	if err != nil {
@@ -449,7 +895,7 @@ func (cfg *apiConfig) getChirpByID(w http.ResponseWriter, r *http.Request){
 		respondWithError(w, http.StatusNotFound, "Chirp not found")
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, chirp)
+	cfg.respondWithChirp(w, r, viewer, http.StatusCreated, chirp)
 }
 
 func (cfg *apiConfig) deleteChirpByID(w http.ResponseWriter, r *http.Request){
@@ -458,17 +904,11 @@ func (cfg *apiConfig) deleteChirpByID(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-
-	user_id, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
+	user_id := caller.UserID
 
 	chirpIDstr := r.PathValue("chirpid")
 	chirpID, err := uuid.Parse(chirpIDstr)
@@ -486,7 +926,7 @@ func (cfg *apiConfig) deleteChirpByID(w http.ResponseWriter, r *http.Request){
 	}
 
 	if chirp.UserID == user_id {
-		err = cfg.db.DeleteChirpsByID(r.Context(), chirpID)
+		err = cfg.db.SoftDeleteChirp(r.Context(), chirpID)
 		if err != nil {
 			respondWithError(w, http.StatusNotFound, "Chirp not found")
 			return
@@ -541,6 +981,92 @@ func (cfg *apiConfig) polkaWebhookHandler(w http.ResponseWriter, r *http.Request
 	respondWithError(w, http.StatusNoContent, "")
 }
 
+// passwordHasherFromEnv builds the hasher for new passwords from
+// PASSWORD_HASHER ("argon2id" or "bcrypt") and its cost settings. Unset
+// settings keep their defaults.
+func passwordHasherFromEnv() (auth.PasswordHasher, error) {
+	envUint := func(name string, value *uint32) error {
+		raw := os.Getenv(name)
+		if raw == "" {
+			return nil
+		}
+		parsed, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*value = uint32(parsed)
+		return nil
+	}
+
+	switch os.Getenv("PASSWORD_HASHER") {
+	case "", "argon2id":
+		hasher := auth.DefaultArgon2idHasher
+		parallelism := uint32(hasher.Parallelism)
+		if err := envUint("ARGON2_MEMORY_KIB", &hasher.Memory); err != nil {
+			return nil, err
+		}
+		if err := envUint("ARGON2_ITERATIONS", &hasher.Iterations); err != nil {
+			return nil, err
+		}
+		if err := envUint("ARGON2_PARALLELISM", &parallelism); err != nil {
+			return nil, err
+		}
+		if parallelism == 0 || parallelism > 255 {
+			return nil, fmt.Errorf("ARGON2_PARALLELISM must be between 1 and 255")
+		}
+		hasher.Parallelism = uint8(parallelism)
+		if err := hasher.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid ARGON2_* settings: %w", err)
+		}
+		return hasher, nil
+	case "bcrypt":
+		cost := uint32(bcrypt.DefaultCost)
+		if err := envUint("BCRYPT_COST", &cost); err != nil {
+			return nil, err
+		}
+		if int(cost) < bcrypt.MinCost || int(cost) > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return auth.BcryptHasher{Cost: int(cost)}, nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASHER %q", os.Getenv("PASSWORD_HASHER"))
+	}
+}
+
+// passwordPolicyFromEnv starts from auth.DefaultPasswordPolicy and applies
+// PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH and the PASSWORD_REQUIRE_UPPER,
+// _LOWER, _DIGIT and _SYMBOL switches.
+func passwordPolicyFromEnv() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	for name, value := range map[string]*int{
+		"PASSWORD_MIN_LENGTH": &policy.MinLength,
+		"PASSWORD_MAX_LENGTH": &policy.MaxLength,
+	} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return policy, fmt.Errorf("invalid %s: %q", name, raw)
+		}
+		*value = parsed
+	}
+	if policy.MaxLength < policy.MinLength {
+		return policy, fmt.Errorf("PASSWORD_MAX_LENGTH must not be less than PASSWORD_MIN_LENGTH")
+	}
+
+	for name, value := range map[string]*bool{
+		"PASSWORD_REQUIRE_UPPER": &policy.RequireUpper,
+		"PASSWORD_REQUIRE_LOWER": &policy.RequireLower,
+		"PASSWORD_REQUIRE_DIGIT": &policy.RequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL": &policy.RequireSymbol,
+	} {
+		*value = os.Getenv(name) == "true"
+	}
+	return policy, nil
+}
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -549,8 +1075,19 @@ func main() {
 
 	dbURL := os.Getenv("DB_URL")
 	tokenSecret := os.Getenv("JWT_SECRET")
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	signingKeyID := os.Getenv("JWT_SIGNING_KEY_ID")
 	platform := os.Getenv("PLATFORM")
 	polkaKey := os.Getenv("POLKA_KEY")
+	mailerKind := os.Getenv("MAILER")
+	mailDir := os.Getenv("MAIL_DIR")
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	bootstrapAdminEmail := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	introspectionKey := os.Getenv("INTROSPECTION_KEY")
 	if dbURL == "" {
 		log.Fatal("DB_URL not found in env")
 	}
@@ -567,8 +1104,49 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	keys := auth.NewHMACKeySet(tokenSecret)
+	if keysDir != "" {
+		keys, err = auth.LoadKeySet(keysDir, signingKeyID)
+		if err != nil {
+			log.Fatalf("couldn't load signing keys: %s", err)
+		}
+		if tokenSecret != "" {
+			keys.AddHMACVerifier(tokenSecret)
+		}
+	}
+
+
+	hasher, err := passwordHasherFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't configure password hashing: %s", err)
+	}
+
+	passwordPolicy, err := passwordPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't configure password policy: %s", err)
+	}
+	passwordPolicy = passwordPolicy.ForHasher(hasher)
+
+	chirpRestoreWindow, chirpRetention, err := chirpDeletionFromEnv()
+	if err != nil {
+		log.Fatalf("couldn't configure chirp deletion: %s", err)
+	}
+
+	mail, err := mailer.New(mailerKind, mailDir)
+	if err != nil {
+		log.Fatalf("couldn't set up mailer: %s", err)
+	}
+
+	cfg := apiConfig{db: dbQueries, conn: db, platform: platform, keys: keys, polkaKey: polkaKey, mailer: mail, passwords: auth.NewPasswords(hasher), passwordPolicy: passwordPolicy, baseURL: baseURL, requireVerifiedEmail: requireVerifiedEmail, bootstrapAdminEmail: bootstrapAdminEmail, introspectionKey: introspectionKey, chirpRestoreWindow: chirpRestoreWindow, chirpRetention: chirpRetention}
+
+	if bootstrapAdminEmail != "" {
+		cfg.bootstrapAdmin(context.Background())
+	}
 
-	cfg := apiConfig{db: dbQueries, platform: platform, tokenSecret: tokenSecret, polkaKey: polkaKey}
+	go runPeriodically(context.Background(), revokedTokenCleanupInterval, cfg.purgeRevokedAccessTokens)
+	go runPeriodically(context.Background(), loginFailurePurgeInterval, cfg.purgeLoginFailures)
+	go runPeriodically(context.Background(), deletedChirpPurgeInterval, cfg.purgeDeletedChirps)
+	go cfg.backfillHashtags(context.Background())
 
 	serverHandler := http.NewServeMux()
 
@@ -576,18 +1154,69 @@ func main() {
 	// serverHandler.Handle("/assets", http.FileServer(http.Dir(".")))
 
 	serverHandler.HandleFunc("GET /api/healthz", readinessHandler)
-	serverHandler.HandleFunc("GET /admin/metrics", cfg.metricsHandler)
-	serverHandler.HandleFunc("POST /admin/reset", cfg.userResetHandler)
+	serverHandler.HandleFunc("GET /.well-known/jwks.json", cfg.jwksHandler)
+	serverHandler.HandleFunc("GET /admin/metrics", cfg.requireRole(auth.RoleAdmin, cfg.metricsHandler))
+	serverHandler.HandleFunc("POST /admin/reset", cfg.requireRole(auth.RoleAdmin, cfg.userResetHandler))
+	serverHandler.HandleFunc("PUT /admin/users/{id}/role", cfg.requireRole(auth.RoleAdmin, cfg.setUserRoleHandler))
+	serverHandler.HandleFunc("POST /admin/impersonate", cfg.requireRole(auth.RoleAdmin, cfg.impersonateHandler))
+	serverHandler.HandleFunc("GET /admin/impersonations", cfg.requireRole(auth.RoleAdmin, cfg.listImpersonationsHandler))
+	serverHandler.HandleFunc("GET /admin/chirps/{chirpid}", cfg.requireRole(auth.RoleModerator, cfg.moderatorChirpHandler))
 	serverHandler.HandleFunc("POST /api/users", cfg.PostUsersHandler)
 	serverHandler.HandleFunc("POST /api/chirps", cfg.postChirpsHandler)
 	serverHandler.HandleFunc("GET /api/chirps", cfg.getChirpsHandler)
+	serverHandler.HandleFunc("GET /api/chirps/search", cfg.searchChirpsHandler)
 	serverHandler.HandleFunc("GET /api/chirps/{chirpid}", cfg.getChirpByID)
 	serverHandler.HandleFunc("DELETE /api/chirps/{chirpid}", cfg.deleteChirpByID)
+	serverHandler.HandleFunc("PUT /api/chirps/{chirpid}", cfg.editChirpHandler)
+	serverHandler.HandleFunc("PATCH /api/chirps/{chirpid}", cfg.editChirpHandler)
+	serverHandler.HandleFunc("GET /api/chirps/{chirpid}/revisions", cfg.chirpRevisionsHandler)
+	serverHandler.HandleFunc("POST /api/chirps/{chirpid}/restore", cfg.restoreChirpHandler)
+	serverHandler.HandleFunc("GET /api/chirps/{chirpid}/replies", cfg.chirpRepliesHandler)
+	serverHandler.HandleFunc("GET /api/chirps/{chirpid}/thread", cfg.chirpThreadHandler)
+	serverHandler.HandleFunc("POST /api/chirps/{chirpid}/rechirp", cfg.rechirpHandler)
+	serverHandler.HandleFunc("DELETE /api/chirps/{chirpid}/rechirp", cfg.undoRechirpHandler)
+	serverHandler.HandleFunc("POST /api/chirps/{chirpid}/likes", cfg.likeChirpHandler)
+	serverHandler.HandleFunc("DELETE /api/chirps/{chirpid}/likes", cfg.unlikeChirpHandler)
+	serverHandler.HandleFunc("GET /api/chirps/{chirpid}/likes", cfg.chirpLikesHandler)
+	serverHandler.HandleFunc("POST /api/chirps/{chirpid}/bookmark", cfg.bookmarkChirpHandler)
+	serverHandler.HandleFunc("DELETE /api/chirps/{chirpid}/bookmark", cfg.removeBookmarkHandler)
+	serverHandler.HandleFunc("GET /api/bookmarks", cfg.listBookmarksHandler)
+	serverHandler.HandleFunc("GET /api/hashtags/{tag}/chirps", cfg.hashtagChirpsHandler)
 	serverHandler.HandleFunc("POST /api/login", cfg.loginHandler)
+	serverHandler.HandleFunc("POST /api/login/mfa", cfg.loginMFAHandler)
+	serverHandler.HandleFunc("POST /api/mfa/totp/enroll", cfg.enrollTOTPHandler)
+	serverHandler.HandleFunc("POST /api/mfa/totp/confirm", cfg.confirmTOTPHandler)
+	serverHandler.HandleFunc("POST /api/mfa/totp/disable", cfg.disableTOTPHandler)
 	serverHandler.HandleFunc("POST /api/refresh", cfg.refreshUserToken)
 	serverHandler.HandleFunc("POST /api/revoke", cfg.refreshTokenRevoke)
 	serverHandler.HandleFunc("PUT /api/users", cfg.updateUsers)
+	serverHandler.HandleFunc("DELETE /api/users", cfg.deleteUserHandler)
+	serverHandler.HandleFunc("GET /api/users/me", cfg.currentUserHandler)
+	serverHandler.HandleFunc("GET /api/users/verify", cfg.verifyEmailLinkHandler)
+	serverHandler.HandleFunc("POST /api/users/verify", cfg.verifyEmailHandler)
+	serverHandler.HandleFunc("POST /api/users/verify/resend", cfg.resendEmailVerificationHandler)
 	serverHandler.HandleFunc("POST /api/polka/webhooks", cfg.polkaWebhookHandler)
+	serverHandler.HandleFunc("GET /api/sessions", cfg.listSessionsHandler)
+	serverHandler.HandleFunc("DELETE /api/sessions/{id}", cfg.revokeSessionHandler)
+	serverHandler.HandleFunc("POST /api/logout-all", cfg.logoutAllHandler)
+	serverHandler.HandleFunc("POST /api/tokens", cfg.createAccessTokenHandler)
+	serverHandler.HandleFunc("GET /api/tokens", cfg.listAccessTokensHandler)
+	serverHandler.HandleFunc("DELETE /api/tokens/{id}", cfg.revokeAccessTokenHandler)
+	serverHandler.HandleFunc("POST /api/oauth/clients", cfg.createOAuthClientHandler)
+	serverHandler.HandleFunc("GET /api/oauth/clients", cfg.listOAuthClientsHandler)
+	serverHandler.HandleFunc("DELETE /api/oauth/clients/{id}", cfg.deleteOAuthClientHandler)
+	serverHandler.HandleFunc("GET /oauth/clients/{id}", cfg.oauthClientInfoHandler)
+	serverHandler.HandleFunc("GET /oauth/authorize", cfg.authorizeHandler)
+	serverHandler.HandleFunc("GET /oauth/consent", oauthConsentHandler)
+	// The fileserver would serve the consent page without the headers
+	// that keep it from being framed.
+	serverHandler.Handle("/app/oauth/", http.NotFoundHandler())
+	serverHandler.HandleFunc("POST /oauth/authorize", cfg.approveAuthorizationHandler)
+	serverHandler.HandleFunc("POST /oauth/token", cfg.oauthTokenHandler)
+	serverHandler.HandleFunc("POST /oauth/revoke", cfg.oauthRevokeHandler)
+	serverHandler.HandleFunc("POST /api/introspect", cfg.introspectHandler)
+	serverHandler.HandleFunc("POST /api/password-reset/request", cfg.passwordResetRequestHandler)
+	serverHandler.HandleFunc("POST /api/password-reset/confirm", cfg.passwordResetConfirmHandler)
 
 	server := &http.Server{
 		Addr:    ":8080",
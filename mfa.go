@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+const (
+	mfaTokenExpiration = 5 * time.Minute
+	recoveryCodeCount  = 10
+	totpIssuer         = "Chirpy"
+)
+
+// respondWithMFAChallenge answers a login with a correct password for a user
+// who has two-factor authentication enabled. The challenge token has to be
+// exchanged together with a second factor at /api/login/mfa.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	mfaToken, err := cfg.keys.MakeMFAToken(user.ID, mfaTokenExpiration)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate MFA token")
+		return
+	}
+
+	type challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	respondWithJSON(w, http.StatusOK, challenge{MFARequired: true, MFAToken: mfaToken})
+}
+
+func (cfg *apiConfig) loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	var req parameters
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	userID, err := cfg.keys.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil || !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	// Guessing the second factor counts against the same account limit as
+	// guessing the password.
+	throttles := []loginThrottle{accountThrottle(user.Email), ipThrottle(r)}
+	if !cfg.checkLoginLockout(w, r, throttles...) {
+		return
+	}
+
+	if !cfg.checkSecondFactor(r, user, req.Code, req.RecoveryCode) {
+		cfg.recordLoginFailure(r, throttles...)
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	cfg.clearLoginFailures(r, user.Email)
+	cfg.issueSession(w, r, user)
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Either is consumed: a TOTP code can't be used again, nor can any
+// code from before it.
+func (cfg *apiConfig) checkSecondFactor(r *http.Request, user database.User, code, recoveryCode string) bool {
+	if code != "" {
+		return cfg.useTOTPCode(r.Context(), user, code)
+	}
+	if recoveryCode == "" {
+		return false
+	}
+
+	used, err := cfg.db.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+	})
+	return err == nil && used == 1
+}
+
+// useTOTPCode checks code against the user's TOTP secret and records its
+// time step. The update only succeeds for a step after the stored one, so two
+// requests racing with the same code can't both be accepted.
+func (cfg *apiConfig) useTOTPCode(ctx context.Context, user database.User, code string) bool {
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now(), user.TotpLastStep)
+	if !ok {
+		return false
+	}
+
+	used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	return err == nil && used == 1
+}
+
+func (cfg *apiConfig) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate TOTP secret")
+		return
+	}
+
+	err = cfg.db.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store TOTP secret")
+		return
+	}
+
+	type enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	respondWithJSON(w, http.StatusOK, enrollment{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+func (cfg *apiConfig) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	var req parameters
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "Start enrollment before confirming it")
+		return
+	}
+
+	if !cfg.useTOTPCode(r.Context(), user, req.Code) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate recovery codes")
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DeleteUserRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+
+	for _, code := range codes {
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(code),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+			return
+		}
+	}
+
+	err = qtx.EnableUserTOTP(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+
+	type confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithJSON(w, http.StatusOK, confirmation{RecoveryCodes: codes})
+}
+
+func (cfg *apiConfig) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	var req parameters
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+
+	// A stolen access token must not become a way around the login limit
+	// for guessing the second factor.
+	throttles := []loginThrottle{accountThrottle(user.Email), ipThrottle(r)}
+	if !cfg.checkLoginLockout(w, r, throttles...) {
+		return
+	}
+
+	if !cfg.checkSecondFactor(r, user, req.Code, req.RecoveryCode) {
+		cfg.recordLoginFailure(r, throttles...)
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+	cfg.clearLoginFailures(r, user.Email)
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DisableUserTOTP(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+
+	err = qtx.DeleteUserRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
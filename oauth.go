@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+const (
+	oauthCodeExpiration        = 10 * time.Minute
+	oauthAccessTokenExpiration = time.Hour
+	maxOAuthClientNameLength   = 100
+	// oauthConsentPage receives the authorization request in its query
+	// string. It is served from oauthConsentFile by oauthConsentHandler.
+	oauthConsentPage = "/oauth/consent"
+	oauthConsentFile = "oauth/consent.html"
+)
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientResponse(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// validRedirectURI only accepts absolute https URIs, plus http on the
+// loopback interface for clients under development.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+// respondWithOAuthError responds in the error format of RFC 6749, section
+// 5.2, which OAuth client libraries expect from the token endpoint.
+func respondWithOAuthError(w http.ResponseWriter, code int, errorCode, description string) {
+	type oauthError struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}
+	respondWithJSON(w, code, oauthError{Error: errorCode, Description: description})
+}
+
+func (cfg *apiConfig) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	var req parameters
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	if req.Name == "" || len(req.Name) > maxOAuthClientNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters")
+		return
+	}
+	if len(req.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one redirect URI is required")
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			respondWithError(w, http.StatusBadRequest, "Invalid redirect URI: "+uri)
+			return
+		}
+	}
+
+	// Public clients, such as single-page and mobile apps, can't keep a
+	// secret and rely on PKCE alone.
+	secret := ""
+	secretHash := sql.NullString{}
+	if req.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create client")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         req.Name,
+		SecretHash:   secretHash,
+		RedirectUris: req.RedirectURIs,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create client")
+		return
+	}
+
+	// The secret itself is only ever shown in this response.
+	response := oauthClientResponse(client)
+	response.Secret = secret
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	dbClients, err := cfg.db.GetOAuthClientsByOwnerID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list clients")
+		return
+	}
+
+	clients := []OAuthClient{}
+	for _, client := range dbClients {
+		clients = append(clients, oauthClientResponse(client))
+	}
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+func (cfg *apiConfig) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+
+	// Codes and refresh tokens issued to the client are deleted with it.
+	deleted, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete client")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// oauthClientInfoHandler tells the consent page which application is asking
+// for access.
+func (cfg *apiConfig) oauthClientInfoHandler(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+
+	type clientInfo struct {
+		ID   uuid.UUID `json:"client_id"`
+		Name string    `json:"name"`
+	}
+	respondWithJSON(w, http.StatusOK, clientInfo{ID: client.ID, Name: client.Name})
+}
+
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// lookupClient finds the client of an authorization request and checks the
+// redirect URI. If either is wrong, errors can't be sent back to the client
+// by redirecting, because the redirect target isn't trusted.
+func (cfg *apiConfig) lookupClient(ctx context.Context, req authorizationRequest) (database.OauthClient, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+
+	client, err := cfg.db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+
+	for _, uri := range client.RedirectUris {
+		if uri == req.RedirectURI {
+			return client, nil
+		}
+	}
+	return database.OauthClient{}, errors.New("redirect URI is not registered for this client")
+}
+
+// validate checks the rest of an authorization request. Problems are
+// reported to the client as an RFC 6749 error code and description.
+func (req authorizationRequest) validate() (scopes []string, errorCode, description string) {
+	if req.ResponseType != "code" {
+		return nil, "unsupported_response_type", "Only the authorization code flow is supported"
+	}
+	// PKCE is required for every client, as recommended by OAuth 2.1.
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, "invalid_request", "A code_challenge with code_challenge_method S256 is required"
+	}
+	scopes, err := auth.ParseScopes(strings.Fields(req.Scope))
+	if err != nil {
+		return nil, "invalid_scope", err.Error()
+	}
+	if len(scopes) == 0 {
+		return nil, "invalid_scope", "At least one scope is required"
+	}
+	return scopes, "", ""
+}
+
+// redirectURL adds params to the query of the client's redirect URI.
+func (req authorizationRequest) redirectURL(params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (req authorizationRequest) errorURL(errorCode, description string) string {
+	return req.redirectURL(url.Values{
+		"error":             {errorCode},
+		"error_description": {description},
+	})
+}
+
+// authorizeHandler starts the authorization code flow. After checking the
+// request it sends the user to the consent page, which signs the user in and
+// posts the decision back to approveAuthorizationHandler.
+func (cfg *apiConfig) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := authorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	if _, err := cfg.lookupClient(r.Context(), req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, errorCode, description := req.validate(); errorCode != "" {
+		http.Redirect(w, r, req.errorURL(errorCode, description), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, oauthConsentPage+"?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// oauthConsentHandler serves the consent page. It asks for the user's
+// password, so other sites must not be able to frame it, and it must not be
+// cached.
+func oauthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, oauthConsentFile)
+}
+
+func (cfg *apiConfig) approveAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+	}
+	var req parameters
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	client, err := cfg.lookupClient(r.Context(), req.authorizationRequest)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The consent page follows redirect_to, since a redirect in response to
+	// a fetch wouldn't navigate the browser.
+	type decision struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	scopes, errorCode, description := req.validate()
+	if errorCode != "" {
+		respondWithJSON(w, http.StatusOK, decision{RedirectTo: req.errorURL(errorCode, description)})
+		return
+	}
+
+	if !req.Approve {
+		respondWithJSON(w, http.StatusOK, decision{RedirectTo: req.errorURL("access_denied", "The user denied access")})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code")
+		return
+	}
+
+	err = cfg.db.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeExpiration),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, decision{RedirectTo: req.redirectURL(url.Values{"code": {code}})})
+}
+
+// authenticateOAuthClient identifies the client calling the token or
+// revocation endpoint, from HTTP Basic credentials or the client_id and
+// client_secret form fields. Confidential clients must present their secret.
+func (cfg *apiConfig) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	client := database.OauthClient{}
+	clientID, err := uuid.Parse(id)
+	if err == nil {
+		client, err = cfg.db.GetOAuthClient(r.Context(), clientID)
+	}
+	if err == nil && client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			err = errors.New("wrong client secret")
+		}
+	}
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return database.OauthClient{}, false
+	}
+	return client, true
+}
+
+func (cfg *apiConfig) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		cfg.refreshOAuthToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	code, err := cfg.db.ConsumeAuthorizationCode(r.Context(), auth.HashToken(r.PostFormValue("code")))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, used or expired authorization code")
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectUri != r.PostFormValue("redirect_uri") {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was issued for a different client or redirect URI")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code_verifier")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), code.UserID)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Couldn't find the user")
+		return
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create refresh token")
+		return
+	}
+
+	sessionID := uuid.New()
+	accessToken, err := cfg.signOAuthAccessToken(user, client, sessionID, code.Scopes)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create access token")
+		return
+	}
+
+	_, err = cfg.db.CreateToken(r.Context(), database.CreateTokenParams{
+		Token:                refreshToken,
+		UserID:               user.ID,
+		ExpiresAt:            time.Now().Add(refreshTokenExpiration),
+		FamilyID:             sessionID,
+		UserAgent:            r.UserAgent(),
+		IpAddress:            clientIP(r),
+		ClientID:             uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:               code.Scopes,
+		AccessTokenID:        accessToken.nullID(),
+		AccessTokenExpiresAt: accessToken.nullExpiresAt(),
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create refresh token")
+		return
+	}
+
+	respondWithOAuthTokens(w, accessToken, code.Scopes, refreshToken)
+}
+
+func (cfg *apiConfig) refreshOAuthToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	stored, err := cfg.db.GetUserToken(r.Context(), r.PostFormValue("refresh_token"))
+	if err != nil || stored.ClientID != (uuid.NullUUID{UUID: client.ID, Valid: true}) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), stored.UserID)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Couldn't find the user")
+		return
+	}
+
+	accessToken, err := cfg.signOAuthAccessToken(user, client, stored.FamilyID, stored.Scopes)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create access token")
+		return
+	}
+
+	refreshToken, err := cfg.rotateRefreshToken(r, stored, accessToken)
+	switch {
+	case errors.Is(err, errRefreshTokenReused), errors.Is(err, errRefreshTokenRevoked), errors.Is(err, errRefreshTokenExpired):
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	case err != nil:
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't rotate refresh token")
+		return
+	}
+
+	respondWithOAuthTokens(w, accessToken, stored.Scopes, refreshToken)
+}
+
+// signOAuthAccessToken issues an access token limited to scopes for client.
+func (cfg *apiConfig) signOAuthAccessToken(user database.User, client database.OauthClient, sessionID uuid.UUID, scopes []string) (signedAccessToken, error) {
+	token := accessTokenFor(user, sessionID)
+	token.ClientID = client.ID.String()
+	token.Scopes = scopes
+	return cfg.signAccessToken(token, oauthAccessTokenExpiration)
+}
+
+// respondWithOAuthTokens sends a token response as in RFC 6749, section 5.1.
+func respondWithOAuthTokens(w http.ResponseWriter, accessToken signedAccessToken, scopes []string, refreshToken string) {
+	type tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	respondWithJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  accessToken.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenExpiration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// oauthRevokeHandler implements RFC 7009 for refresh tokens. Revoking one
+// ends the whole authorization it belongs to. Unknown tokens are not an
+// error, so the response doesn't reveal whether a token existed.
+func (cfg *apiConfig) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	stored, err := cfg.db.GetUserToken(r.Context(), r.PostFormValue("token"))
+	if err == nil && stored.ClientID == (uuid.NullUUID{UUID: client.ID, Valid: true}) {
+		if err := cfg.endSession(r.Context(), stored.FamilyID); err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't revoke token")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/pagination"
+)
+
+// chirpCursor is the sort key of the last chirp on a page. The next page
+// starts right after it.
+type chirpCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// chirpCursorAfter is the cursor for the page after the chirp last.
+func chirpCursorAfter(last database.Chirp) any {
+	return chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+}
+
+// fetchPage returns a page of at most limit items. fetch runs the query with
+// the limit it is given, which is one more than requested: the extra item
+// tells whether there is a next page. If there is, it is dropped and a Link
+// header points at the page after the last item, with cursorAfter giving its
+// cursor.
+func fetchPage[T any](cfg *apiConfig, w http.ResponseWriter, r *http.Request, limit int,
+	fetch func(limit int32) ([]T, error), cursorAfter func(last T) any) ([]T, error) {
+	items, err := fetch(int32(limit + 1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+		if err := cfg.setNextLink(w, r, cursorAfter(items[limit-1])); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// setNextLink sets a Link header pointing at the next page: the same request
+// with its cursor replaced by one encoding after.
+func (cfg *apiConfig) setNextLink(w http.ResponseWriter, r *http.Request, after any) error {
+	cursor, err := pagination.EncodeCursor(after)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, cfg.baseURL, next.String()))
+	return nil
+}
+
+// parseTimeParam reads an optional RFC 3339 timestamp from the query
+// parameter name.
+func parseTimeParam(r *http.Request, name string) (sql.NullTime, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
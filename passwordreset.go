@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/mailer"
+)
+
+// Every reset request sends an email, so requests are limited per address
+// asked for and per client address, or the endpoint could flood an inbox.
+// They are counted in login_failures under keys of their own.
+var (
+	resetEmailLockoutPolicy = auth.LockoutPolicy{
+		Threshold: 3,
+		BaseDelay: 15 * time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+	resetIPLockoutPolicy = auth.LockoutPolicy{
+		Threshold: 10,
+		BaseDelay: 15 * time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+)
+
+func resetEmailThrottle(email string) loginThrottle {
+	return loginThrottle{key: "reset-email:" + strings.ToLower(strings.TrimSpace(email)), policy: resetEmailLockoutPolicy}
+}
+
+func resetIPThrottle(r *http.Request) loginThrottle {
+	return loginThrottle{key: "reset-ip:" + clientIP(r), policy: resetIPLockoutPolicy}
+}
+
+const (
+	passwordResetExpiration = time.Hour
+	// passwordResetSendTimeout bounds the work done for a reset request
+	// after the response has gone out.
+	passwordResetSendTimeout = time.Minute
+)
+
+func (cfg *apiConfig) passwordResetRequestHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	var req parameters
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	// The response is the same whether or not the account exists so the
+	// endpoint can't be used to discover registered emails, and the same
+	// when the request is over the limit and nothing is sent. It doesn't
+	// wait for the email either: only a registered email means creating a
+	// token and sending mail, and the time that takes would tell the two
+	// apart.
+	throttles := []loginThrottle{resetEmailThrottle(req.Email), resetIPThrottle(r)}
+	if cfg.lockedFor(r.Context(), throttles...) > 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	// Every request counts, the way a failed login does.
+	cfg.recordLoginFailure(r, throttles...)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), passwordResetSendTimeout)
+		defer cancel()
+		cfg.sendPasswordReset(ctx, req.Email)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset emails a reset token to the account registered with email,
+// if there is one. Failures are only logged.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("couldn't create password reset token: %s", err)
+		return
+	}
+
+	err = cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetExpiration),
+	})
+	if err != nil {
+		log.Printf("couldn't store password reset token: %s", err)
+		return
+	}
+
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Your reset token is: %s\n\n"+
+			"It expires in %s and can only be used once. If you didn't ask for this, you can ignore this email.",
+			token, passwordResetExpiration),
+	})
+	if err != nil {
+		log.Printf("couldn't send password reset email: %s", err)
+	}
+}
+
+func (cfg *apiConfig) passwordResetConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	var req parameters
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	// The email rule is checked once the token tells us whose password this
+	// is.
+	if violations := cfg.passwordPolicy.Validate(req.Password); violations != nil {
+		respondWithPasswordViolations(w, violations)
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(req.Password)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't hash password")
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userID, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(req.Token))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+	if violations := cfg.passwordPolicy.Validate(req.Password, user.Email); violations != nil {
+		// Rolling back leaves the token usable for another attempt.
+		respondWithPasswordViolations(w, violations)
+		return
+	}
+
+	err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	// Any other outstanding reset link and every existing session belong to
+	// the old password.
+	err = qtx.ExpireUserPasswordResetTokens(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	err = qtx.RevokeUserAccessTokens(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	err = qtx.RevokeAllUserTokens(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runPeriodically calls task right away and then every interval until ctx
+// is cancelled. Runs never overlap; a slow run delays the next one.
+func runPeriodically(ctx context.Context, interval time.Duration, task func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		task(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
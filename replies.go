@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/database"
+	"github.com/sabrek15/chirpy/internal/pagination"
+)
+
+const (
+	// maxThreadDepth bounds how many levels of replies a thread follows up
+	// and down from a chirp.
+	maxThreadDepth = 100
+	// maxThreadReplies bounds how many replies a thread includes.
+	maxThreadReplies = 500
+)
+
+// ChirpThread is a chirp with the conversation around it.
+type ChirpThread struct {
+	// Ancestors are the chirps the chirp replies to, the first one first.
+	Ancestors []Chirp `json:"ancestors"`
+	Chirp     Chirp   `json:"chirp"`
+	// Replies are the replies to the chirp and to its replies, oldest
+	// first. Each one's reply_to_id tells where it belongs.
+	Replies        []Chirp `json:"replies"`
+	HasMoreReplies bool    `json:"has_more_replies"`
+}
+
+// chirpRepliesHandler lists the direct replies to a chirp, oldest first.
+func (cfg *apiConfig) chirpRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := cfg.viewerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	if _, err := cfg.db.GetChirpsByID(r.Context(), chirpID); err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	limit, err := pagination.ParseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpRepliesParams{ReplyToID: chirpID}
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		var cursor chirpCursor
+		if err := pagination.DecodeCursor(cursorParam, &cursor); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.AfterCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	replies, err := fetchPage(cfg, w, r, limit, func(limit int32) ([]database.Chirp, error) {
+		params.Limit = limit
+		return cfg.db.ListChirpReplies(r.Context(), params)
+	}, chirpCursorAfter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list replies")
+		return
+	}
+	cfg.respondWithChirps(w, r, viewer, http.StatusOK, replies)
+}
+
+// chirpThreadHandler returns a chirp with every chirp it replies to and
+// every reply below it. Deleted chirps are left out, but the chirps around
+// them are still part of the thread.
+func (cfg *apiConfig) chirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := cfg.viewerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	chirp, err := cfg.db.GetChirpsByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread")
+		return
+	}
+
+	ancestors, err := cfg.db.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ID:       chirp.ID,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread")
+		return
+	}
+
+	replies, err := cfg.db.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ID:       chirp.ID,
+		MaxDepth: maxThreadDepth,
+		Limit:    maxThreadReplies + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread")
+		return
+	}
+	hasMore := len(replies) > maxThreadReplies
+	if hasMore {
+		replies = replies[:maxThreadReplies]
+	}
+
+	// Annotating the whole thread at once keeps the number of queries fixed.
+	all := make([]database.Chirp, 0, len(ancestors)+1+len(replies))
+	all = append(all, ancestors...)
+	all = append(all, chirp)
+	all = append(all, replies...)
+	chirps := chirpsFromDB(all)
+	if err := cfg.annotateChirps(r.Context(), viewer, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't load chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpThread{
+		Ancestors:      chirps[:len(ancestors)],
+		Chirp:          chirps[len(ancestors)],
+		Replies:        chirps[len(ancestors)+1:],
+		HasMoreReplies: hasMore,
+	})
+}
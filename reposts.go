@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+// repostTarget returns the chirp that reposting or replying to chirpID is
+// about. That is the chirp itself, unless it is a rechirp, which has nothing
+// of its own.
+func (cfg *apiConfig) repostTarget(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.db.GetChirpsByID(ctx, chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if chirp.Kind != chirpKindRechirp {
+		return chirp, nil
+	}
+	if !chirp.QuotedChirpID.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return cfg.db.GetChirpsByID(ctx, chirp.QuotedChirpID.UUID)
+}
+
+// rechirpHandler reposts a chirp as it is. Each user can rechirp a chirp
+// once.
+func (cfg *apiConfig) rechirpHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	if !cfg.checkCanPost(w, r, caller) {
+		return
+	}
+
+	original, err := cfg.repostTarget(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rechirp")
+		return
+	}
+
+	rechirp, err := cfg.db.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:        caller.UserID,
+		QuotedChirpID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "Chirp is already rechirped")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rechirp")
+		return
+	}
+	cfg.respondWithChirp(w, r, caller.UserID, http.StatusCreated, rechirp)
+}
+
+// undoRechirpHandler removes the caller's rechirp of a chirp. It works even
+// after the chirp has been deleted.
+func (cfg *apiConfig) undoRechirpHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpid"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't parse chirp id")
+		return
+	}
+
+	// A rechirp holds nothing worth restoring, so it is removed for good.
+	deleted, err := cfg.db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:        caller.UserID,
+		QuotedChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't undo rechirp")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Chirp isn't rechirped")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+// revokedTokenCleanupInterval is how often expired entries are removed from
+// the access token denylist.
+const revokedTokenCleanupInterval = time.Hour
+
+// signedAccessToken is an access token together with what is needed to
+// revoke it before it expires.
+type signedAccessToken struct {
+	Token     string
+	ID        uuid.UUID
+	ExpiresAt time.Time
+}
+
+// signAccessToken signs token with a fresh token ID. The ID and expiry are
+// stored with the session's refresh token so that ending the session can
+// also revoke the access token.
+func (cfg *apiConfig) signAccessToken(token auth.AccessToken, expiresIn time.Duration) (signedAccessToken, error) {
+	token.ID = uuid.New()
+	signed, err := cfg.keys.MakeJWT(token, expiresIn)
+	if err != nil {
+		return signedAccessToken{}, err
+	}
+	// Taken after signing, so it is never earlier than the exp claim.
+	expiresAt := time.Now().Add(expiresIn)
+	return signedAccessToken{Token: signed, ID: token.ID, ExpiresAt: expiresAt}, nil
+}
+
+func (t signedAccessToken) nullID() uuid.NullUUID {
+	return uuid.NullUUID{UUID: t.ID, Valid: true}
+}
+
+func (t signedAccessToken) nullExpiresAt() sql.NullTime {
+	return sql.NullTime{Time: t.ExpiresAt, Valid: true}
+}
+
+// parseAccessToken verifies an access token and checks that it hasn't been
+// revoked since it was issued.
+func (cfg *apiConfig) parseAccessToken(ctx context.Context, token string) (*auth.Claims, error) {
+	claims, err := cfg.keys.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := cfg.db.IsAccessTokenRevoked(ctx, uuid.MustParse(claims.ID))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, errors.New("token has been revoked")
+	}
+	return claims, nil
+}
+
+// validateSession is parseAccessToken for endpoints that need a login
+// session. Tokens issued to OAuth clients and impersonation tokens are
+// rejected, which keeps them away from managing the account.
+func (cfg *apiConfig) validateSession(ctx context.Context, token string) (*auth.Claims, error) {
+	claims, err := cfg.parseAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := claims.RequireSession(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validateJWT returns the user of a login session's access token.
+func (cfg *apiConfig) validateJWT(ctx context.Context, token string) (uuid.UUID, error) {
+	claims, err := cfg.validateSession(ctx, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.MustParse(claims.Subject), nil
+}
+
+// endSession revokes every refresh token of the session familyID and the
+// access tokens issued with them.
+func (cfg *apiConfig) endSession(ctx context.Context, familyID uuid.UUID) error {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.RevokeFamilyAccessTokens(ctx, familyID); err != nil {
+		return err
+	}
+	if err := qtx.RevokeTokenFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteUserHandler deletes the caller's account after confirming their
+// password. Access tokens of the account are revoked first, so none of them
+// outlives it.
+func (cfg *apiConfig) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	claims, err := cfg.validateSession(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	var req parameters
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), uuid.MustParse(claims.Subject))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+
+	// A stolen access token must not be enough to guess the password here
+	// instead of at the login endpoint.
+	throttle := accountThrottle(user.Email)
+	if !cfg.checkLoginLockout(w, r, throttle) {
+		return
+	}
+	if _, err := cfg.passwords.Verify(user.HashedPassword, req.Password); err != nil {
+		cfg.recordLoginFailure(r, throttle)
+		respondWithError(w, http.StatusUnauthorized, invalidCredentialsMessage)
+		return
+	}
+
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// The presented token is revoked explicitly, since it might predate
+	// tracking access tokens with their session.
+	err = qtx.RevokeAccessToken(r.Context(), database.RevokeAccessTokenParams{
+		Jti:       uuid.MustParse(claims.ID),
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account")
+		return
+	}
+
+	err = qtx.RevokeUserAccessTokens(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account")
+		return
+	}
+
+	err = qtx.DeleteUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account")
+		return
+	}
+
+	cfg.clearLoginFailures(r, user.Email)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeRevokedAccessTokens removes denylist entries for tokens that have
+// expired anyway.
+func (cfg *apiConfig) purgeRevokedAccessTokens(ctx context.Context) {
+	deleted, err := cfg.db.DeleteExpiredRevokedAccessTokens(ctx)
+	if err != nil {
+		log.Printf("couldn't purge revoked access tokens: %s", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("purged %d expired revoked access tokens", deleted)
+	}
+}
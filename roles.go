@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sabrek15/chirpy/internal/auth"
+	"github.com/sabrek15/chirpy/internal/database"
+)
+
+type claimsContextKey struct{}
+
+// requireRole only lets requests through from login sessions of users who
+// have min or a higher role. The token's claims are available to next through
+// claimsFromContext.
+func (cfg *apiConfig) requireRole(min auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		claims, err := cfg.parseAccessToken(r.Context(), token)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		// Scoped tokens never reach admin endpoints, whoever they were
+		// issued for.
+		if !claims.IsSession() {
+			respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		// The role claim is only as fresh as the token. The stored role is
+		// what counts, so a demotion takes effect right away.
+		user, err := cfg.db.GetUserByID(r.Context(), uuid.MustParse(claims.Subject))
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find the user")
+			return
+		}
+		claims.Role = auth.Role(user.Role)
+		if !claims.Role.AtLeast(min) {
+			respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims)))
+	}
+}
+
+// claimsFromContext returns the access token claims stored by requireRole.
+func claimsFromContext(ctx context.Context) *auth.Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(*auth.Claims)
+	return claims
+}
+
+func (cfg *apiConfig) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Admins can't demote themselves, so there is always at least one admin
+	// left who can undo a mistake.
+	if claimsFromContext(r.Context()).Subject == userID.String() {
+		respondWithError(w, http.StatusBadRequest, "Can't change your own role")
+		return
+	}
+
+	defer r.Body.Close()
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	var req parameters
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went Wrong")
+		return
+	}
+
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := cfg.db.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{
+		ID:   userID,
+		Role: string(role),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find the user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update role")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role:          user.Role,
+	})
+}
+
+// bootstrapAdmin makes the user with the verified address
+// BOOTSTRAP_ADMIN_EMAIL an admin if there is no admin yet, and reports
+// whether it did. It does nothing once an admin exists, so the setting can
+// stay in place.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context) bool {
+	promoted, err := cfg.db.PromoteBootstrapAdmin(ctx, cfg.bootstrapAdminEmail)
+	if err != nil {
+		log.Printf("couldn't bootstrap admin: %s", err)
+		return false
+	}
+	if promoted == 0 {
+		return false
+	}
+	log.Printf("promoted %s to admin", cfg.bootstrapAdminEmail)
+	return true
+}
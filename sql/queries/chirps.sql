@@ -1,21 +1,220 @@
 -- name: CreateChrips :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
-VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, reply_to_id, kind, quoted_chirp_id)
+VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
 RETURNING *;
 
--- name: GetChirps :many
+-- name: CreateRechirp :one
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, kind, quoted_chirp_id)
+VALUES(gen_random_uuid(), NOW(), NOW(), '', $1, 'rechirp', $2)
+ON CONFLICT (user_id, quoted_chirp_id) WHERE kind = 'rechirp' AND deleted_at IS NULL DO NOTHING
+RETURNING *;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE
+    user_id = $1
+    AND quoted_chirp_id = $2
+    AND kind = 'rechirp';
+
+-- name: ListChirps :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE
+    deleted_at IS NULL
+    AND (
+        kind <> 'rechirp'
+        OR EXISTS (
+            SELECT 1 FROM chirps AS original
+            WHERE original.id = chirps.quoted_chirp_id AND original.deleted_at IS NULL
+        )
+    )
+    AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+    AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('after_created_at'), sqlc.narg('after_id')::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
 
--- name: GetChirpsByAuthorID :many
+-- name: ListChirpsDesc :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE
+    deleted_at IS NULL
+    AND (
+        kind <> 'rechirp'
+        OR EXISTS (
+            SELECT 1 FROM chirps AS original
+            WHERE original.id = chirps.quoted_chirp_id AND original.deleted_at IS NULL
+        )
+    )
+    AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+    AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) < (sqlc.narg('after_created_at'), sqlc.narg('after_id')::uuid)
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: GetChirpsByID :one
 SELECT * FROM chirps
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+    AND (
+        kind <> 'rechirp'
+        OR EXISTS (
+            SELECT 1 FROM chirps AS original
+            WHERE original.id = chirps.quoted_chirp_id AND original.deleted_at IS NULL
+        )
+    );
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE
+    id = ANY(sqlc.arg('ids')::uuid[])
+    AND deleted_at IS NULL;
+
+-- name: GetChirpIncludingDeleted :one
+SELECT * FROM chirps
 WHERE id = $1;
 
--- name: DeleteChirpsByID :exec
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE
+    id = $1
+    AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET
+    body = $2,
+    updated_at = NOW(),
+    edited_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE
+    id = $1
+    AND deleted_at IS NULL;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL
+WHERE
+    id = $1
+    AND user_id = $2
+    AND deleted_at > $3
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE deleted_at < $1;
+-- name: SearchChirps :many
+WITH matches AS (
+    SELECT
+        chirps.id,
+        chirps.created_at,
+        chirps.updated_at,
+        chirps.body,
+        chirps.user_id,
+        chirps.edited_at,
+        chirps.reply_to_id,
+        chirps.kind,
+        chirps.quoted_chirp_id,
+        ts_rank(chirps.search_vector, query) AS rank,
+        query
+    FROM chirps, to_tsquery('english', sqlc.arg('query')) AS query
+    WHERE
+        chirps.search_vector @@ query
+        AND chirps.deleted_at IS NULL
+        AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id'))
+)
+SELECT
+    id,
+    created_at,
+    updated_at,
+    body,
+    user_id,
+    edited_at,
+    reply_to_id,
+    kind,
+    quoted_chirp_id,
+    rank,
+    ts_headline('english', body, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20')::text AS headline
+FROM matches
+WHERE
+    sqlc.narg('after_rank')::real IS NULL
+    OR (rank, created_at, id) < (sqlc.narg('after_rank'), sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpReplies :many
+SELECT * FROM chirps
+WHERE
+    reply_to_id = sqlc.arg('reply_to_id')::uuid
+    AND deleted_at IS NULL
+    AND (
+        sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('after_created_at'), sqlc.narg('after_id')::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: CountChirpReplies :many
+SELECT reply_to_id::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE
+    reply_to_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+    AND deleted_at IS NULL
+GROUP BY reply_to_id;
+
+-- name: CountChirpReposts :many
+SELECT
+    quoted_chirp_id::uuid AS chirp_id,
+    COUNT(*) FILTER (WHERE kind = 'rechirp') AS rechirp_count,
+    COUNT(*) FILTER (WHERE kind = 'quote') AS quote_count
+FROM chirps
+WHERE
+    quoted_chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+    AND deleted_at IS NULL
+GROUP BY quoted_chirp_id;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT reply_to_id AS id, 1 AS depth
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+    UNION ALL
+    SELECT chirps.reply_to_id, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+    WHERE ancestors.depth < sqlc.arg('max_depth')
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+WHERE chirps.deleted_at IS NULL
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, 1 AS depth
+    FROM chirps
+    WHERE reply_to_id = sqlc.arg('id')::uuid
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.reply_to_id = descendants.id
+    WHERE descendants.depth < sqlc.arg('max_depth')
+)
+SELECT chirps.* FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE chirps.deleted_at IS NULL
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,41 @@
+-- name: CreateHashtags :exec
+INSERT INTO hashtags(id, tag, created_at)
+SELECT gen_random_uuid(), tag, NOW()
+FROM unnest(sqlc.arg('tags')::text[]) AS tag
+ON CONFLICT (tag) DO NOTHING;
+
+-- name: AddChirpHashtags :exec
+INSERT INTO chirp_hashtags(chirp_id, hashtag_id)
+SELECT sqlc.arg('chirp_id'), id
+FROM hashtags
+WHERE tag = ANY(sqlc.arg('tags')::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: ListHashtagChirps :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE
+    hashtags.tag = sqlc.arg('tag')
+    AND chirps.deleted_at IS NULL
+    AND (
+        sqlc.narg('before_created_at')::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < (sqlc.narg('before_created_at'), sqlc.narg('before_id')::uuid)
+    )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListHashtagBackfill :many
+SELECT chirps.* FROM hashtag_backfill
+JOIN chirps ON chirps.id = hashtag_backfill.chirp_id
+ORDER BY hashtag_backfill.chirp_id
+LIMIT $1
+FOR UPDATE OF chirps;
+
+-- name: DeleteHashtagBackfill :exec
+DELETE FROM hashtag_backfill
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
@@ -0,0 +1,15 @@
+-- name: CreateImpersonation :one
+INSERT INTO impersonations(id, admin_id, user_id, reason, token_id, user_agent, ip_address, created_at, expires_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW(), $7)
+RETURNING *;
+
+-- name: GetImpersonations :many
+SELECT * FROM impersonations
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: GetImpersonationsByUserID :many
+SELECT * FROM impersonations
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
@@ -0,0 +1,30 @@
+-- name: GetLoginFailure :one
+SELECT * FROM login_failures
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures(key, failures, last_failed_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET
+    failures = CASE
+        WHEN login_failures.last_failed_at < $2 THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failed_at = NOW()
+RETURNING failures;
+
+-- name: LockLogin :exec
+UPDATE login_failures
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
+
+-- name: PurgeLoginFailures :execrows
+DELETE FROM login_failures
+WHERE
+    last_failed_at < $1
+    AND (locked_until IS NULL OR locked_until < NOW());
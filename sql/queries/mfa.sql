@@ -0,0 +1,49 @@
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET
+    totp_secret = $2,
+    totp_enabled_at = NULL,
+    totp_last_step = 0,
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET
+    totp_enabled_at = NOW(),
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET
+    totp_secret = NULL,
+    totp_enabled_at = NULL,
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes(user_id, code_hash, created_at)
+VALUES ($1, $2, NOW());
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE
+    user_id = $1
+    AND code_hash = $2
+    AND used_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE
+    id = $1
+    AND totp_last_step < $2;
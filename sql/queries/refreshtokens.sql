@@ -1,6 +1,6 @@
 -- name: CreateToken :one
-INSERT INTO refreshtokens(token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
+INSERT INTO refreshtokens(token, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip_address, last_used_at, client_id, scopes, access_token_id, access_token_expires_at)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, NOW(), $7, $8, $9, $10)
 RETURNING *;
 
 -- name: GetUserToken :one
@@ -10,4 +10,69 @@ WHERE token = $1;
 -- name: RevokeRefreshToken :exec
 UPDATE refreshtokens
 SET revoked_at = NOW() -- Or $2 if you want to pass the timestamp from Go
-WHERE token = $1;
\ No newline at end of file
+WHERE token = $1;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW(),
+    replaced_by = $2
+WHERE
+    token = $1
+    AND revoked_at IS NULL;
+
+-- name: RevokeTokenFamily :exec
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1
+    AND revoked_at IS NULL;
+
+-- name: GetActiveSessionsByUserID :many
+SELECT * FROM refreshtokens
+WHERE
+    user_id = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeUserTokenFamily :execrows
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
+
+-- name: RevokeAllUserTokens :exec
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND revoked_at IS NULL;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refreshtokens
+    WHERE
+        family_id = $1
+        AND revoked_at IS NULL
+        AND expires_at > NOW()
+);
+
+-- name: RevokeOtherUserTokens :exec
+UPDATE refreshtokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1
+    AND family_id <> $2
+    AND revoked_at IS NULL;
@@ -0,0 +1,57 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens(jti, expires_at, revoked_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: RevokeFamilyAccessTokens :exec
+INSERT INTO revoked_access_tokens(jti, expires_at, revoked_at)
+SELECT access_token_id, access_token_expires_at, NOW()
+FROM refreshtokens
+WHERE
+    family_id = $1
+    AND access_token_id IS NOT NULL
+    AND access_token_expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: RevokeUserAccessTokens :exec
+INSERT INTO revoked_access_tokens(jti, expires_at, revoked_at)
+SELECT access_token_id, access_token_expires_at, NOW()
+FROM refreshtokens
+WHERE
+    refreshtokens.user_id = $1
+    AND access_token_id IS NOT NULL
+    AND access_token_expires_at > NOW()
+UNION ALL
+SELECT token_id, expires_at, NOW()
+FROM impersonations
+WHERE
+    impersonations.user_id = $1
+    AND expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: RevokeOtherUserAccessTokens :exec
+INSERT INTO revoked_access_tokens(jti, expires_at, revoked_at)
+SELECT access_token_id, access_token_expires_at, NOW()
+FROM refreshtokens
+WHERE
+    refreshtokens.user_id = $1
+    AND family_id <> $2
+    AND access_token_id IS NOT NULL
+    AND access_token_expires_at > NOW()
+UNION ALL
+SELECT token_id, expires_at, NOW()
+FROM impersonations
+WHERE
+    impersonations.user_id = $1
+    AND expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM revoked_access_tokens
+    WHERE jti = $1
+);
+
+-- name: DeleteExpiredRevokedAccessTokens :execrows
+DELETE FROM revoked_access_tokens
+WHERE expires_at <= NOW();
@@ -11,6 +11,11 @@ SELECT *
 FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
 -- name: UpdateUserCredentials :one
 UPDATE users
 SET
@@ -27,4 +32,45 @@ SET
     is_chirpy_red = TRUE,
     updated_at = NOW()
 WHERE
-    id = $1;
\ No newline at end of file
+    id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    hashed_password = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET
+    email = $2,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE
+    id = $1
+RETURNING *;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+RETURNING *;
+
+-- name: PromoteBootstrapAdmin :execrows
+UPDATE users
+SET
+    role = 'admin',
+    updated_at = NOW()
+WHERE
+    email = $1
+    AND email_verified_at IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin');
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
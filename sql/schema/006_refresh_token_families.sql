@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE refreshtokens
+ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+ADD COLUMN replaced_by TEXT;
+
+CREATE INDEX refreshtokens_family_id_idx ON refreshtokens(family_id);
+
+-- +goose Down
+DROP INDEX refreshtokens_family_id_idx;
+
+ALTER TABLE refreshtokens
+DROP COLUMN replaced_by,
+DROP COLUMN family_id;
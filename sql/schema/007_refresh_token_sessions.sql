@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE refreshtokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX refreshtokens_user_id_idx ON refreshtokens(user_id);
+
+-- +goose Down
+DROP INDEX refreshtokens_user_id_idx;
+
+ALTER TABLE refreshtokens
+DROP COLUMN last_used_at,
+DROP COLUMN ip_address,
+DROP COLUMN user_agent;
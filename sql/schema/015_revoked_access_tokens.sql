@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE refreshtokens
+ADD COLUMN access_token_id UUID,
+ADD COLUMN access_token_expires_at TIMESTAMP;
+
+-- Entries outlive the user on purpose: tokens of a deleted account must stay
+-- rejected until they expire.
+CREATE TABLE revoked_access_tokens(
+    jti UUID PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_access_tokens_expires_at_idx ON revoked_access_tokens(expires_at);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
+
+ALTER TABLE refreshtokens
+DROP COLUMN access_token_expires_at,
+DROP COLUMN access_token_id;
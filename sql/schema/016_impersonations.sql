@@ -0,0 +1,20 @@
+-- +goose Up
+-- The audit trail outlives the accounts it mentions, so neither user is a
+-- foreign key.
+CREATE TABLE impersonations(
+    id UUID PRIMARY KEY,
+    admin_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    token_id UUID NOT NULL UNIQUE,
+    user_agent TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX impersonations_user_id_idx ON impersonations(user_id);
+CREATE INDEX impersonations_created_at_idx ON impersonations(created_at);
+
+-- +goose Down
+DROP TABLE impersonations;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN kind TEXT NOT NULL DEFAULT 'chirp' CHECK (kind IN ('chirp', 'rechirp', 'quote')),
+ADD COLUMN quoted_chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD CONSTRAINT chirps_quoted_chirp_id_check CHECK (kind <> 'chirp' OR quoted_chirp_id IS NULL);
+
+CREATE INDEX chirps_quoted_chirp_id_idx ON chirps(quoted_chirp_id) WHERE quoted_chirp_id IS NOT NULL;
+
+CREATE UNIQUE INDEX chirps_rechirp_unique_idx ON chirps(user_id, quoted_chirp_id)
+WHERE kind = 'rechirp' AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX chirps_rechirp_unique_idx;
+DROP INDEX chirps_quoted_chirp_id_idx;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_quoted_chirp_id_check,
+DROP COLUMN quoted_chirp_id,
+DROP COLUMN kind;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Chirps from before hashtags were indexed. The server indexes them in the
+-- background and removes them from here as it goes.
+CREATE TABLE hashtag_backfill(
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+INSERT INTO hashtag_backfill(chirp_id)
+SELECT id FROM chirps
+WHERE body LIKE '%#%' OR body LIKE '%＃%';
+
+-- +goose Down
+DROP TABLE hashtag_backfill;